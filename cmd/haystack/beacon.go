@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/beacon"
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+var batteryStatuses = map[string]byte{
+	"full":     findmy.StatusBatteryFull,
+	"medium":   findmy.StatusBatteryMedium,
+	"low":      findmy.StatusBatteryLow,
+	"critical": findmy.StatusBatteryCritical,
+}
+
+func runBeacon(args []string) error {
+	flags := flag.NewFlagSet("beacon", flag.ExitOnError)
+	keys := flags.String("keys", "", "A .keys file or a directory of .keys files to advertise")
+	dev := flags.Int("hci", 0, "Number of the Bluetooth controller to use (hciN)")
+	interval := flags.Duration("interval", beacon.DefaultInterval, "Advertising interval")
+	rotate := flags.Duration("rotate", beacon.DefaultRotation, "Time each static key is advertised for, when there is more than one")
+	battery := flags.String("battery", "full", "Advertised battery status: full, medium, low or critical")
+	logFile := flags.String("log", "", "Write the log to this file instead of stderr")
+	logFormat := flags.String("log-format", "json", "Log format: json or text")
+	var txPower *int8
+	flags.Func("tx-power", "Transmit power in dBm, requires a controller supporting extended advertising", func(s string) error {
+		p, err := strconv.ParseInt(s, 10, 8)
+		if err != nil {
+			return err
+		}
+		power := int8(p)
+		txPower = &power
+		return nil
+	})
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: haystack beacon -keys KEYS [options]\n")
+		fmt.Fprintf(os.Stderr, "Advertises through a raw HCI socket instead of BlueZ, as BlueZ cannot set the advertised address,\n")
+		fmt.Fprintf(os.Stderr, "which carries the first bytes of the key. Requires root or CAP_NET_RAW and CAP_NET_ADMIN, and\n")
+		fmt.Fprintf(os.Stderr, "BlueZ must not advertise on the same controller at the same time.\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *keys == "" {
+		return errors.New("please provide a keys file or directory with -keys")
+	}
+	status, ok := batteryStatuses[*battery]
+	if !ok {
+		return fmt.Errorf("unsupported battery status: %s", *battery)
+	}
+
+	var out io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	var logger *slog.Logger
+	switch *logFormat {
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(out, nil))
+	case "text":
+		logger = slog.New(slog.NewTextHandler(out, nil))
+	default:
+		return fmt.Errorf("unsupported log format: %s", *logFormat)
+	}
+
+	devices, err := loadDevices(*keys)
+	if err != nil {
+		return err
+	}
+
+	hci, err := beacon.OpenHCI(*dev, beacon.HCIOptions{Interval: *interval, TxPower: txPower})
+	if err != nil {
+		return err
+	}
+	defer hci.Close()
+
+	b, err := beacon.New(hci, devices, beacon.Config{Rotation: *rotate, Status: status, Logger: logger})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("starting beacon", "devices", len(devices), "hci", *dev, "interval", interval.String())
+	if err := b.Run(ctx); err != nil {
+		logger.Error("beacon failed", "error", err)
+		return err
+	}
+	logger.Info("beacon stopped")
+	return nil
+}
+
+// loadDevices loads a single .keys file or all .keys files in a directory.
+func loadDevices(path string) ([]device.Device, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		devices, err := device.LoadFromDir(path)
+		if err == nil && len(devices) == 0 {
+			err = fmt.Errorf("no .keys files in %s", path)
+		}
+		return devices, err
+	}
+
+	d, err := device.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []device.Device{*d}, nil
+}
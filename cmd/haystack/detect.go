@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/scanner"
+	"tinygo.org/x/bluetooth"
+)
+
+// detectAlert is a single line of the JSON detect output.
+type detectAlert struct {
+	Time      time.Time `json:"time"`
+	Key       string    `json:"key"`
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Following string    `json:"following"`
+	Sightings int       `json:"sightings"`
+	Windows   int       `json:"windows"`
+	MinRSSI   int16     `json:"minRssi"`
+	MaxRSSI   int16     `json:"maxRssi"`
+	MeanRSSI  int16     `json:"meanRssi"`
+	Battery   string    `json:"battery"`
+}
+
+func detectTrackers(args []string, verboseFlag *bool) error {
+	config := scanner.DefaultDetectorConfig
+	flags := flag.NewFlagSet("detect", flag.ExitOnError)
+	format := flags.String("format", "text", "Output format: text or json (one alert per line)")
+	keysDir := flags.String("keys", "", "Directory with .keys files of own devices, which are never reported")
+	flags.DurationVar(&config.Window, "window", config.Window, "Length of the time windows sightings are counted in")
+	flags.IntVar(&config.MinWindows, "windows", config.MinWindows, "Number of distinct windows a device must be seen in")
+	flags.DurationVar(&config.MinDuration, "following", config.MinDuration, "Minimum time a device must be following before it is reported")
+	rssi := flags.Int("rssi", int(config.MinRSSI), "Minimum average signal strength in dBm of a reported device")
+	flags.DurationVar(&config.Forget, "forget", config.Forget, "Forget devices not seen for this duration")
+	flags.DurationVar(&config.Realert, "realert", config.Realert, "Report a device that is still following again after this duration, 0 reports it only once")
+	duration := flags.Duration("duration", 0, "Stop detecting after this duration, 0 runs forever")
+	flags.Parse(args)
+	config.MinRSSI = int16(*rssi)
+
+	var alert func(scanner.Candidate)
+	switch *format {
+	case "text":
+		alert = printAlert
+	case "json":
+		alert = jsonAlert(json.NewEncoder(os.Stdout))
+	default:
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+
+	var known *scanner.Known
+	if *keysDir != "" {
+		devices, err := device.LoadFromDir(*keysDir)
+		if err != nil {
+			return err
+		}
+		if known, err = scanner.NewKnown(devices); err != nil {
+			return err
+		}
+	}
+	detector := scanner.NewDetector(config, known)
+
+	adapter := scanner.Bluetooth(bluetooth.DefaultAdapter)
+	if err := adapter.Enable(); err != nil {
+		return err
+	}
+
+	s := scanner.New(adapter)
+	if *duration > 0 {
+		time.AfterFunc(*duration, func() {
+			s.Stop()
+		})
+	}
+	if *verboseFlag {
+		go func() {
+			for range time.Tick(config.Window) {
+				println("tracking", len(detector.Candidates()), "unknown devices")
+			}
+		}()
+	}
+	return s.Scan(detector.Handler(alert))
+}
+
+func printAlert(c scanner.Candidate) {
+	println("ALERT: unknown FindMy device", c.Address, "following for", c.Following().Round(time.Minute).String(),
+		"- seen", c.Sightings, "times in", c.Windows, "windows, RSSI", c.MinRSSI, "to", c.MaxRSSI, "- battery", c.Battery())
+	println("  key", c.KeyHex())
+}
+
+func jsonAlert(enc *json.Encoder) func(scanner.Candidate) {
+	return func(c scanner.Candidate) {
+		out := detectAlert{
+			Time:      time.Now(),
+			Key:       c.KeyHex(),
+			Address:   c.Address,
+			FirstSeen: c.FirstSeen,
+			LastSeen:  c.LastSeen,
+			Following: c.Following().Round(time.Second).String(),
+			Sightings: c.Sightings,
+			Windows:   c.Windows,
+			MinRSSI:   c.MinRSSI,
+			MaxRSSI:   c.MaxRSSI,
+			MeanRSSI:  c.MeanRSSI,
+			Battery:   c.Battery(),
+		}
+		if err := enc.Encode(out); err != nil {
+			println("failed to write alert:", err.Error())
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/geofence"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+func runGeofence(args []string, dir string) error {
+	flags := flag.NewFlagSet("geofence", flag.ExitOnError)
+	rulesFile := flags.String("rules", "", "Geofence rules file")
+	keys := flags.String("keys", "", "A .keys file or a directory of .keys files to watch, instead of the devices in the registry")
+	endpoint := flags.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
+	days := flags.Int("days", 1, "Number of days to retrieve reports for")
+	historyFile := flags.String("history", "", "File to keep the location history in")
+	timeout := flags.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
+	flags.Parse(args)
+
+	if *rulesFile == "" {
+		return errors.New("please provide a rules file with -rules")
+	}
+	config, err := geofence.LoadConfig(*rulesFile)
+	if err != nil {
+		return err
+	}
+
+	notifiers := map[string]geofence.Notifier{}
+	if len(config.Notifiers) == 0 {
+		config.Notifiers = map[string]geofence.NotifierConfig{"log": {Type: "log"}}
+	}
+	for name, nc := range config.Notifiers {
+		if notifiers[name], err = geofence.NewNotifier(nc); err != nil {
+			return err
+		}
+	}
+
+	var devices []device.Device
+	if *keys != "" {
+		devices, err = loadDevices(*keys)
+	} else {
+		var registry *device.Registry
+		if registry, err = openRegistry(dir); err == nil {
+			devices, err = registry.List()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices to watch, create one with 'haystack keys' or use -keys")
+	}
+
+	var store *history.Store
+	if *historyFile != "" {
+		if store, err = history.Open(*historyFile); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	evaluator, err := geofence.NewEvaluator(config.Zones, config.EvaluatorConfig)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := reports.NewClient(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
+	interval := time.Duration(config.Interval)
+	if interval <= 0 {
+		interval = geofence.DefaultInterval
+	}
+	slog.Info("watching zones", "zones", len(config.Zones), "devices", len(devices), "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// the reports of the first retrieval only set where the devices are, so restarts do not repeat old events
+	initial := true
+	for {
+		deviceReports, err := client.Get(ctx, devices)
+		if err != nil && !errors.As(err, &reports.NonFatalError{}) {
+			slog.Error("failed to get reports", "error", err)
+		} else {
+			if err != nil {
+				slog.Warn("reports retrieved with errors", "error", err)
+			}
+			if store != nil {
+				if _, err := store.Add(deviceReports); err != nil {
+					slog.Error("failed to store reports", "error", err)
+				}
+			}
+			for i := range devices {
+				d := &devices[i]
+				events := evaluator.Evaluate(d, deviceReports[d.ID])
+				if initial {
+					slog.Info("initial state", "device", d.Name, "zones", evaluator.Inside(d.ID))
+					continue
+				}
+				notifyEvents(ctx, config, notifiers, events)
+			}
+			initial = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifyEvents sends the events to the notifiers selected by the rules.
+func notifyEvents(ctx context.Context, config *geofence.Config, notifiers map[string]geofence.Notifier, events []geofence.Event) {
+	for _, e := range events {
+		for _, name := range config.Route(e) {
+			if err := notifiers[name].Notify(ctx, e); err != nil {
+				slog.Error("failed to notify", "notifier", name, "event", e.String(), "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+// importDevices imports accessories exported by OpenHaystack or macless-haystack into the registry.
+func importDevices(args []string, dir string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Only print the accessories found in the files")
+	encrypt := flags.Bool("encrypt", false, "Encrypt the imported keys files with a passphrase")
+	force := flags.Bool("force", false, "Overwrite the keys of existing devices")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("please provide the files to import")
+	}
+
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range flags.Args() {
+		devices, err := device.ImportFile(fileName)
+		if err != nil {
+			return err
+		}
+		for i := range devices {
+			d := &devices[i]
+			if *dryRun {
+				fmt.Printf("%s: %d keys, %s\n", d.Name, len(d.StaticKeys()), d.ID)
+				continue
+			}
+
+			d.Encrypted = *encrypt
+			save := registry.Add
+			if *force {
+				save = registry.Replace
+			}
+			if err := save(d); err != nil {
+				if errors.Is(err, device.ErrExists) {
+					return fmt.Errorf("device %s already exists, use -force to overwrite its keys", d.Name)
+				}
+				return err
+			}
+			fmt.Println("imported", d.Name, "to", registry.Path(d.Name, ".keys"))
+			if err := saveDeviceFile(registry, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,18 +1,31 @@
 package main
 
 import (
-	"encoding/base64"
 	"errors"
+	"time"
 
 	"github.com/HattoriHanzo031/go-haystack/lib/device"
 )
 
-var errInvalidHash = errors.New("Hash contains '/'")
+// generateDevice generates a device with count static keys it rotates through,
+// or with keys derived every interval from its master key if interval is not zero.
+func generateDevice(name string, count int, interval time.Duration) (*device.Device, error) {
+	if count < 1 {
+		return nil, errors.New("at least one key is required")
+	}
+	if interval != 0 {
+		if count != 1 {
+			return nil, errors.New("devices using key derivation have no additional keys")
+		}
+		return device.GenerateDerived(name, time.Now(), interval)
+	}
 
-func generateKey() (string, string, string, error) {
-	d, err := device.Generate("")
+	d, err := device.Generate(name)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
+	}
+	if err := d.AddKeys(count - 1); err != nil {
+		return nil, err
 	}
-	return base64.StdEncoding.EncodeToString(d.PrivateKey), d.AdvertisementKey, d.ID, nil
+	return d, nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,71 +9,200 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
 )
 
 func main() {
 	verboseFlag := flag.Bool("v", false, "enable verbose mode")
+	dirFlag := flag.String("dir", "", "device registry directory (default $HAYSTACK_DIR or the haystack directory in the user config directory)")
 	flag.Parse()
 
 	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Println("subcommand required. valid subcommands are 'keys' 'flash' 'scan'")
+		printSubcommands()
 		return
 	}
 
 	switch args[0] {
 	case "keys":
-		if len(args) < 2 {
-			fmt.Println("Please provide a device name")
-			return
-		}
-		if err := generateKeys(args[1], verboseFlag); err != nil {
+		if err := generateKeys(args[1:], *dirFlag, verboseFlag); err != nil {
 			fmt.Println("failed to generate keys:", err)
 		}
 	case "flash":
-		if len(args) < 3 {
-			fmt.Println("Please provide a device name and target")
-			return
-		}
-		if err := flashDevice(args[1], args[2], verboseFlag); err != nil {
+		if err := flashDevice(args[1:], *dirFlag, verboseFlag); err != nil {
 			fmt.Println("failed to flash device:", err)
 		}
+	case "list":
+		if err := listDevices(*dirFlag); err != nil {
+			fmt.Println("failed to list devices:", err)
+		}
+	case "show":
+		if err := showDevice(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to show device:", err)
+		}
+	case "rm":
+		if err := removeDevice(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to remove device:", err)
+		}
+	case "import":
+		if err := importDevices(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to import devices:", err)
+		}
+	case "export":
+		if err := exportDevices(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to export devices:", err)
+		}
 	case "scan":
-		if err := scanDevices(verboseFlag); err != nil {
+		if err := scanDevices(args[1:], verboseFlag); err != nil {
 			fmt.Println("failed to scan devices:", err)
 		}
+	case "detect":
+		if err := detectTrackers(args[1:], verboseFlag); err != nil {
+			fmt.Println("failed to detect trackers:", err)
+		}
+	case "beacon":
+		if err := runBeacon(args[1:]); err != nil {
+			fmt.Println("failed to run beacon:", err)
+			os.Exit(1)
+		}
+	case "serve":
+		if err := serveMap(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to serve map:", err)
+			os.Exit(1)
+		}
+	case "geofence":
+		if err := runGeofence(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to run geofence:", err)
+			os.Exit(1)
+		}
+	case "mqtt":
+		if err := runMQTT(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to run mqtt bridge:", err)
+			os.Exit(1)
+		}
+	case "watch":
+		if err := runWatch(args[1:], *dirFlag); err != nil {
+			fmt.Println("failed to watch reports:", err)
+			os.Exit(1)
+		}
 	default:
-		fmt.Println("subcommand required. valid subcommands are 'keys' 'flash' 'scan'")
+		printSubcommands()
 		return
 	}
 }
 
-func generateKeys(name string, verboseFlag *bool) error {
-	// TODO: check if overwriting keys
+// subcommands are the subcommands handled by main, listed when none or an unknown one is given.
+var subcommands = []string{"keys", "flash", "list", "show", "rm", "import", "export", "scan", "detect", "beacon", "serve", "geofence", "mqtt", "watch"}
 
-	priv, pub, hash, err := generateKey()
+func printSubcommands() {
+	fmt.Printf("subcommand required. valid subcommands are '%s'\n", strings.Join(subcommands, "' '"))
+}
+
+func generateKeys(args []string, dir string, verboseFlag *bool) error {
+	flags := flag.NewFlagSet("keys", flag.ExitOnError)
+	count := flags.Int("n", 1, "Number of keys to generate, the device rotates through them")
+	derive := flags.Duration("derive", 0, "Derive a new key every interval instead of rotating through static keys, such devices can be advertised with beacon but not flashed")
+	encrypt := flags.Bool("encrypt", false, "Encrypt the keys file with a passphrase, encrypts the keys of an existing device in place")
+	force := flags.Bool("force", false, "Overwrite the keys of an existing device")
+	target := flags.String("target", "", "TinyGo target of the device")
+	notes := flags.String("notes", "", "Notes about the device")
+	icon := flags.String("icon", "", "Icon of the device shown by macless-haystack")
+	color := flags.String("color", "", "Color of the device shown by macless-haystack, as #RRGGBB")
+	flags.Parse(args)
+
+	name := flags.Arg(0)
+	if name == "" {
+		return errors.New("please provide a device name")
+	}
+
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+
+	if *encrypt && !*force {
+		if err := encryptKeys(registry, name); !errors.Is(err, device.ErrNotFound) {
+			return err
+		}
+	}
+
+	d, err := generateDevice(name, *count, *derive)
 	if err != nil {
 		return err
 	}
+	d.Encrypted = *encrypt
+	d.Target = *target
+	d.Notes = *notes
+	d.Icon = *icon
+	d.Color = *color
 
 	// Print the keys and hash
 	if *verboseFlag {
-		fmt.Printf("Private key: %s\n", priv)
-		fmt.Printf("Advertisement key: %s\n", pub)
-		fmt.Printf("Hashed adv key: %s\n", hash)
+		for _, k := range d.StaticKeys() {
+			fmt.Printf("Private key: %s\n", base64.StdEncoding.EncodeToString(k.PrivateKey))
+			fmt.Printf("Advertisement key: %s\n", k.AdvertisementKey)
+			fmt.Printf("Hashed adv key: %s\n", k.ID)
+		}
 	}
 
-	// save keys file
-	if err := saveKeys(name, priv, pub, hash); err != nil {
+	// save keys file, existing keys are only replaced once the new keys are saved
+	save := registry.Add
+	if *force {
+		save = registry.Replace
+	}
+	if err := save(d); err != nil {
+		if errors.Is(err, device.ErrExists) {
+			return fmt.Errorf("device %s already exists, use -force to overwrite its keys", name)
+		}
 		return err
 	}
+	fmt.Println("keys saved to", registry.Path(name, ".keys"))
 
-	// save device file
-	return saveDevice(name, priv)
+	return saveDeviceFile(registry, d)
 }
 
-func flashDevice(name string, target string, verboseFlag *bool) error {
-	key, err := readKey(name)
+// encryptKeys encrypts the keys file of an existing device with a passphrase.
+func encryptKeys(registry *device.Registry, name string) error {
+	d, err := registry.Get(name)
+	if err != nil {
+		return err
+	}
+	if d.Encrypted {
+		return errors.New("keys file is already encrypted")
+	}
+	d.Encrypted = true
+	if err := registry.Update(d); err != nil {
+		return err
+	}
+	fmt.Println("keys encrypted in", registry.Path(name, ".keys"))
+	return saveDeviceFile(registry, d)
+}
+
+func flashDevice(args []string, dir string, verboseFlag *bool) error {
+	flags := flag.NewFlagSet("flash", flag.ExitOnError)
+	rotate := flags.Duration("rotate", 15*time.Minute, "Interval the device rotates its keys at, if it has more than one")
+	flags.Parse(args)
+
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+	d, inRegistry, err := lookupDevice(registry, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	target := flags.Arg(1)
+	if target == "" {
+		target = d.Target
+	}
+	if target == "" {
+		return errors.New("please provide a device name and target")
+	}
+
+	keys, err := readKeys(d)
 	if err != nil {
 		return err
 	}
@@ -84,7 +214,7 @@ func flashDevice(name string, target string, verboseFlag *bool) error {
 	}
 	defer os.Chdir(pwd)
 
-	keyVal := fmt.Sprintf("-X main.AdvertisingKey='%s'", key)
+	keyVal := fmt.Sprintf("-X main.AdvertisingKey='%s' -X main.RotationInterval=%s", strings.Join(keys, ","), *rotate)
 	if *verboseFlag {
 		fmt.Println("tinygo", "flash", "-target", target, "-ldflags", keyVal, ".")
 	}
@@ -92,29 +222,27 @@ func flashDevice(name string, target string, verboseFlag *bool) error {
 	cmd := exec.Command("tinygo", "flash", "-target", target, "-ldflags", keyVal, ".")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func readKey(name string) (string, error) {
-	f, err := os.Open(name + ".keys")
-	if err != nil {
-		return "", err
+	if err := cmd.Run(); err != nil {
+		return err
 	}
-	defer f.Close()
 
-	b := make([]byte, 1024)
-	n, err := f.Read(b)
-	if err != nil {
-		return "", err
+	// remember the target for the next flash
+	if inRegistry && d.Target != target {
+		d.Target = target
+		return registry.Update(d)
 	}
+	return nil
+}
 
-	lines := strings.Split(string(b[:n]), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Advertisement key") {
-			s := strings.Split(line, ":")
-			return strings.TrimLeft(s[1], " "), nil
-		}
+// readKeys returns the advertisement keys of the device, in the order they are advertised.
+func readKeys(d *device.Device) ([]string, error) {
+	if d.UsesDerivation() {
+		return nil, errors.New("devices using key derivation are not supported by the firmware, advertise them with haystack beacon instead")
 	}
 
-	return "", errors.New("key not found")
+	var keys []string
+	for _, k := range d.StaticKeys() {
+		keys = append(keys, k.AdvertisementKey)
+	}
+	return keys, nil
 }
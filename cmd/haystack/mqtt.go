@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/homeassistant"
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/scanner"
+	"tinygo.org/x/bluetooth"
+)
+
+func runMQTT(args []string, dir string) error {
+	flags := flag.NewFlagSet("mqtt", flag.ExitOnError)
+	broker := flags.String("broker", "localhost:1883", "Address of the MQTT broker, as host:port or a mqtt:// or mqtts:// URL")
+	username := flags.String("username", "", "User name for the MQTT broker, the password is read from HAYSTACK_MQTT_PASSWORD")
+	clientID := flags.String("client-id", "haystack", "MQTT client ID, unique for each bridge connected to the broker")
+	prefix := flags.String("prefix", homeassistant.DefaultPrefix, "Home Assistant discovery prefix")
+	topic := flags.String("topic", homeassistant.DefaultTopic, "Base topic the state of the devices is published under")
+	keys := flags.String("keys", "", "A .keys file or a directory of .keys files to publish, instead of the devices in the registry")
+	endpoint := flags.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
+	days := flags.Int("days", 1, "Number of days to retrieve reports for")
+	interval := flags.Duration("interval", 15*time.Minute, "Interval reports are retrieved at")
+	timeout := flags.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
+	scannerName := flags.String("scanner", "", "Name of this scanner, such as the room it is in. Enables publishing the signal strength of devices received nearby")
+	minRSSI := flags.Int("rssi", -100, "Ignore advertisements with a weaker signal strength in dBm")
+	silent := flags.Duration("silent", 5*time.Minute, "Report a device as away from the scanner after this duration without advertisements")
+	throttle := flags.Duration("throttle", 10*time.Second, "Minimum interval between signal strength updates of a device")
+	flags.Parse(args)
+	if *silent <= 0 || *interval <= 0 {
+		return errors.New("-silent and -interval must be positive")
+	}
+
+	var devices []device.Device
+	var err error
+	if *keys != "" {
+		devices, err = loadDevices(*keys)
+	} else {
+		var registry *device.Registry
+		if registry, err = openRegistry(dir); err == nil {
+			devices, err = registry.List()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices to publish, create one with 'haystack keys' or use -keys")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	config := homeassistant.Config{Prefix: *prefix, Topic: *topic, Scanner: *scannerName}
+	conn := &brokerConn{
+		broker: *broker,
+		options: mqtt.Options{
+			ClientID: *clientID,
+			Username: *username,
+			Password: os.Getenv("HAYSTACK_MQTT_PASSWORD"),
+			Will:     homeassistant.New(nil, config).Will(),
+		},
+		// the discovery configuration is published again after every reconnect,
+		// in case the broker lost its retained messages
+		onConnect: func(ctx context.Context, client *mqtt.Client) error {
+			b := homeassistant.New(client, config)
+			if err := b.Discover(ctx, devices); err != nil {
+				return err
+			}
+			return b.Online(ctx)
+		},
+	}
+	defer conn.Close()
+	if _, err := conn.connection(ctx); err != nil {
+		return err
+	}
+	bridge := homeassistant.New(conn, config)
+
+	if *scannerName != "" {
+		if err := publishSightings(ctx, bridge, devices, int16(*minRSSI), *silent, *throttle); err != nil {
+			return err
+		}
+	}
+
+	client := reports.NewClient(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
+	slog.Info("publishing to MQTT", "broker", *broker, "devices", len(devices), "interval", interval.String(), "scanner", *scannerName)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	published := map[string]time.Time{}
+	for {
+		deviceReports, err := client.Get(ctx, devices)
+		if err != nil && !errors.As(err, &reports.NonFatalError{}) {
+			slog.Error("failed to get reports", "error", err)
+		} else {
+			if err != nil {
+				slog.Warn("reports retrieved with errors", "error", err)
+			}
+			for i := range devices {
+				d := &devices[i]
+				r, ok := latestReport(deviceReports[d.ID])
+				if !ok || !r.Data.Timestamp.After(published[d.ID]) {
+					continue
+				}
+				if err := bridge.PublishReport(ctx, d, r); err != nil {
+					slog.Error("failed to publish report", "device", d.Name, "error", err)
+					continue
+				}
+				published[d.ID] = r.Data.Timestamp
+				slog.Info("published location", "device", d.Name, "time", r.Data.Timestamp)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// latestReport returns the report with the newest location.
+func latestReport(rs []reports.Report) (reports.Report, bool) {
+	if len(rs) == 0 {
+		return reports.Report{}, false
+	}
+	latest := rs[0]
+	for _, r := range rs[1:] {
+		if r.Data.Timestamp.After(latest.Data.Timestamp) {
+			latest = r
+		}
+	}
+	return latest, true
+}
+
+// publishSightings scans for advertisements of the devices and publishes their signal strength,
+// at most once per throttle interval for each device, and publishes devices as away once they go silent.
+func publishSightings(ctx context.Context, bridge *homeassistant.Bridge, devices []device.Device, minRSSI int16, silent, throttle time.Duration) error {
+	known, err := scanner.NewKnown(devices)
+	if err != nil {
+		return err
+	}
+	adapter := scanner.Bluetooth(bluetooth.DefaultAdapter)
+	if err := adapter.Enable(); err != nil {
+		return err
+	}
+
+	// the scan callback must not block, sightings are dropped while publishing is behind
+	sightings := make(chan scanner.Event, 16)
+	presence := scanner.NewPresence(known, time.Now())
+	handler := scanner.FilterRSSI(minRSSI, presence.Handler(func(e scanner.Event) {
+		if e.Device == nil {
+			return
+		}
+		select {
+		case sightings <- e:
+		default:
+		}
+	}))
+
+	s := scanner.New(adapter)
+	go func() {
+		if err := s.Scan(handler); err != nil {
+			slog.Error("failed to scan", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(min(silent/10, 10*time.Second))
+		defer ticker.Stop()
+		// lastPublished is the time the signal strength of present devices was last published
+		lastPublished := map[string]time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-sightings:
+				d := e.Device
+				if e.Advertisement.Time.Sub(lastPublished[d.ID]) < throttle {
+					continue
+				}
+				if err := bridge.PublishSighting(ctx, d, e.Advertisement.RSSI); err != nil {
+					slog.Error("failed to publish sighting", "device", d.Name, "error", err)
+					continue
+				}
+				lastPublished[d.ID] = e.Advertisement.Time
+			case now := <-ticker.C:
+				for _, a := range presence.NotSeen(now, silent) {
+					if _, ok := lastPublished[a.Device.ID]; !ok {
+						continue
+					}
+					if err := bridge.PublishAway(ctx, &a.Device); err != nil {
+						slog.Error("failed to publish away", "device", a.Device.Name, "error", err)
+						continue
+					}
+					delete(lastPublished, a.Device.ID)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// brokerConn is a connection to the MQTT broker that is reestablished when it is lost.
+type brokerConn struct {
+	broker    string
+	options   mqtt.Options
+	onConnect func(ctx context.Context, client *mqtt.Client) error
+
+	mu     sync.Mutex
+	client *mqtt.Client
+}
+
+func (c *brokerConn) Publish(ctx context.Context, m mqtt.Message) error {
+	client, err := c.connection(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Publish(ctx, m)
+}
+
+// connection returns the current connection, connecting again if it was lost.
+func (c *brokerConn) connection(ctx context.Context) (*mqtt.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		select {
+		case <-c.client.Done():
+			slog.Warn("lost connection to MQTT broker", "error", c.client.Err())
+			c.client = nil
+		default:
+			return c.client, nil
+		}
+	}
+
+	client, err := mqtt.Dial(ctx, c.broker, c.options)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.onConnect(ctx, client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+// Close publishes the will, which the broker does not publish after a clean disconnect, and disconnects.
+func (c *brokerConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return nil
+	}
+	if c.options.Will != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.client.Publish(ctx, *c.options.Will); err != nil {
+			slog.Warn("failed to publish will", "error", err)
+		}
+	}
+	return c.client.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+func openRegistry(dir string) (*device.Registry, error) {
+	if dir == "" {
+		var err error
+		if dir, err = device.DefaultRegistryDir(); err != nil {
+			return nil, err
+		}
+	}
+	return device.OpenRegistry(dir)
+}
+
+// lookupDevice loads a device from the registry, or from NAME.keys in the current directory
+// for devices created before the registry. It reports whether the device is in the registry.
+func lookupDevice(registry *device.Registry, name string) (*device.Device, bool, error) {
+	if name == "" {
+		return nil, false, errors.New("please provide a device name")
+	}
+	d, err := registry.Get(name)
+	if err == nil {
+		return d, true, nil
+	}
+	if !errors.Is(err, device.ErrNotFound) {
+		return nil, false, err
+	}
+	if _, statErr := os.Stat(name + ".keys"); statErr != nil {
+		return nil, false, err
+	}
+	d, err = device.LoadFromFile(name + ".keys")
+	return d, false, err
+}
+
+func listDevices(dir string) error {
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+	devices, err := registry.List()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("no devices in", registry.Dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKEYS\tTARGET\tCREATED\tNOTES")
+	for _, d := range devices {
+		keys := fmt.Sprint(len(d.StaticKeys()))
+		if d.UsesDerivation() {
+			keys = "rolling"
+		}
+		created := "-"
+		if !d.Created.IsZero() {
+			created = d.Created.Local().Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Name, keys, orDash(d.Target), created, orDash(d.Notes))
+	}
+	return w.Flush()
+}
+
+func showDevice(args []string, dir string) error {
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+	d, inRegistry, err := lookupDevice(registry, firstArg(args))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", d.Name)
+	if inRegistry {
+		fmt.Fprintf(w, "Keys file:\t%s\n", registry.Path(d.Name, ".keys"))
+	} else {
+		fmt.Fprintf(w, "Keys file:\t%s\n", d.Name+".keys")
+	}
+	fmt.Fprintf(w, "Encrypted:\t%t\n", d.Encrypted)
+	if !d.Created.IsZero() {
+		fmt.Fprintf(w, "Created:\t%s\n", d.Created.Local().Format(time.DateTime))
+	}
+	for _, meta := range [][2]string{{"Target", d.Target}, {"Notes", d.Notes}, {"Icon", d.Icon}, {"Color", d.Color}} {
+		if meta[1] != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", meta[0], meta[1])
+		}
+	}
+	if d.UsesDerivation() {
+		now := time.Now()
+		fmt.Fprintf(w, "Rolling keys:\tevery %s since %s\n", d.UpdateInterval, d.DerivationStart.Local().Format(time.DateTime))
+		if key, err := d.KeyAt(d.Period(now)); err == nil {
+			fmt.Fprintf(w, "Current key:\t%s (period %d)\n", key.AdvertisementKey, key.Period)
+		}
+	}
+	for i, k := range d.StaticKeys() {
+		fmt.Fprintf(w, "Advertisement key %d:\t%s\n", i+1, k.AdvertisementKey)
+		fmt.Fprintf(w, "Hashed adv key %d:\t%s\n", i+1, k.ID)
+	}
+	return w.Flush()
+}
+
+func removeDevice(args []string, dir string) error {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	force := flags.Bool("f", false, "Do not ask for confirmation")
+	flags.Parse(args)
+
+	name := flags.Arg(0)
+	if name == "" {
+		return errors.New("please provide a device name")
+	}
+	registry, err := openRegistry(dir)
+	if err != nil {
+		return err
+	}
+
+	if !*force {
+		fmt.Printf("Remove device %s and its keys? Reports of the device can not be decrypted without them. [y/N] ", name)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return errors.New("cancelled")
+		}
+	}
+	if err := registry.Remove(name); err != nil {
+		return err
+	}
+	fmt.Println("removed", name)
+	return nil
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -1,77 +1,78 @@
 package main
 
 import (
-	"encoding/base64"
-	"math/rand"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"strconv"
-	"text/template"
 
 	"github.com/HattoriHanzo031/go-haystack/lib/device"
 )
 
-func saveKeys(name string, priv string, pub string, hash string) error {
-	pk, err := base64.StdEncoding.DecodeString(priv)
+// saveDevice saves the accessories file of the devices for macless-haystack.
+func saveDevice(fileName string, devices ...*device.Device) error {
+	data, err := device.MarshalAccessories(devices...)
 	if err != nil {
 		return err
 	}
+	return os.WriteFile(fileName, append(data, '\n'), 0o600)
+}
 
-	device := device.Device{
-		Name:             name,
-		ID:               hash,
-		AdvertisementKey: pub,
-		PrivateKey:       pk,
+// saveDeviceFile saves the accessories file of a device in the registry next to its keys file. For encrypted keys
+// it is not saved and an existing one is removed, since it contains the private key in plain text,
+// 'haystack export' creates it on request.
+func saveDeviceFile(registry *device.Registry, d *device.Device) error {
+	if d.Encrypted {
+		if err := os.Remove(registry.Path(d.Name, ".json")); err == nil {
+			fmt.Println("removed", registry.Path(d.Name, ".json"), "as it contains the private key")
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("device file for macless-haystack not saved as it would contain the private key, create it with 'haystack export -o FILE %s'\n", d.Name)
+		return nil
+	}
+	if err := saveDevice(registry.Path(d.Name, ".json"), d); err != nil {
+		return err
 	}
-	return device.SaveToFile()
+	fmt.Println("device file for macless-haystack saved to", registry.Path(d.Name, ".json"))
+	return nil
 }
 
-const deviceTemplate = `[
-    {
-        "id": {{.ID}},
-        "colorComponents": [
-            0,
-            1,
-            0,
-            1
-        ],
-        "name": "{{.Name}}",
-        "privateKey": "{{.PrivateKey}}",
-        "icon": "",
-        "isDeployed": true,
-        "colorSpaceName": "kCGColorSpaceExtendedSRGB",
-        "usesDerivation": false,
-        "isActive": false,
-        "additionalKeys": []
-    }
-]
-`
+// exportDevices saves the named devices, or all devices in the registry, into one accessories file.
+func exportDevices(args []string, dir string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "accessories.json", "Accessories file to write")
+	flags.Parse(args)
 
-func saveDevice(name string, priv string) error {
-	t, err := template.New("device").Parse(deviceTemplate)
+	registry, err := openRegistry(dir)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.Create(name + ".json")
-	if err != nil {
-		return err
+	var devices []*device.Device
+	if flags.NArg() == 0 {
+		all, err := registry.List()
+		if err != nil {
+			return err
+		}
+		for i := range all {
+			devices = append(devices, &all[i])
+		}
+	}
+	for _, name := range flags.Args() {
+		d, _, err := lookupDevice(registry, name)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, d)
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices to export")
 	}
 
-	defer f.Close()
-
-	err = t.Execute(f, map[string]string{
-		"ID":         randomInt(1000, 999999),
-		"Name":       name,
-		"PrivateKey": priv,
-	})
-	if err != nil {
+	if err := saveDevice(*output, devices...); err != nil {
 		return err
 	}
-
+	fmt.Println(len(devices), "devices exported to", *output)
 	return nil
 }
-
-// Returns an int >= min, < max
-func randomInt(min, max int) string {
-	return strconv.Itoa(min + rand.Intn(max-min))
-}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/scanner"
+	"tinygo.org/x/bluetooth"
+)
+
+// scanEvent is a single line of the JSON scan output.
+type scanEvent struct {
+	Time    time.Time `json:"time"`
+	Address string    `json:"address,omitempty"`
+	RSSI    int16     `json:"rssi,omitempty"`
+	Type    string    `json:"type"`
+	Name    string    `json:"name,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Status  *byte     `json:"status,omitempty"`
+	Battery string    `json:"battery,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	// LastSeen is set for known devices that are not seen anymore, zero if never seen
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+func scanDevices(args []string, verboseFlag *bool) error {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	format := flags.String("format", "text", "Output format: text or json (one event per line)")
+	minRSSI := flags.Int("rssi", -127, "Only show advertisements with a signal strength of at least this many dBm")
+	keysDir := flags.String("keys", "", "Directory with .keys files of known devices")
+	knownOnly := flags.Bool("known", false, "Only show known devices, requires -keys")
+	silent := flags.Duration("silent", 5*time.Minute, "Report known devices as not seen after this duration without advertisements")
+	duration := flags.Duration("duration", 0, "Stop scanning after this duration, 0 scans forever")
+	flags.Parse(args)
+	if *silent <= 0 {
+		return errors.New("-silent must be positive")
+	}
+
+	var handler scanner.Handler
+	var notSeen func(scanner.Absence)
+	switch *format {
+	case "text":
+		handler = printEvent(verboseFlag)
+		notSeen = printNotSeen
+	case "json":
+		enc := &lockedEncoder{enc: json.NewEncoder(os.Stdout)}
+		handler = jsonEvent(enc)
+		notSeen = jsonNotSeen(enc)
+	default:
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+	// the signal strength only filters the output, presence tracks every advertisement of known devices
+	handler = scanner.FilterRSSI(int16(*minRSSI), handler)
+
+	if *knownOnly && *keysDir == "" {
+		return errors.New("-known requires a keys directory")
+	}
+	if *keysDir != "" {
+		devices, err := device.LoadFromDir(*keysDir)
+		if err != nil {
+			return err
+		}
+		known, err := scanner.NewKnown(devices)
+		if err != nil {
+			return err
+		}
+		if *knownOnly {
+			handler = scanner.FilterKnown(known, handler)
+		}
+		presence := scanner.NewPresence(known, time.Now())
+		handler = presence.Handler(handler)
+		go reportNotSeen(presence, *silent, notSeen)
+	}
+
+	adapter := scanner.Bluetooth(bluetooth.DefaultAdapter)
+	if err := adapter.Enable(); err != nil {
+		return err
+	}
+
+	s := scanner.New(adapter)
+	if *verboseFlag {
+		s.OnAdvertisement = func(adv scanner.Advertisement) {
+			println("found device:", adv.Address, adv.RSSI, adv.LocalName)
+		}
+	}
+
+	if *duration > 0 {
+		time.AfterFunc(*duration, func() {
+			s.Stop()
+		})
+	}
+	return s.Scan(handler)
+}
+
+// reportNotSeen periodically reports known devices once they go silent.
+func reportNotSeen(presence *scanner.Presence, silent time.Duration, report func(scanner.Absence)) {
+	reported := map[string]bool{}
+	for now := range time.Tick(min(silent/10, 10*time.Second)) {
+		absent := map[string]bool{}
+		for _, a := range presence.NotSeen(now, silent) {
+			absent[a.Device.ID] = true
+			if !reported[a.Device.ID] {
+				report(a)
+			}
+		}
+		reported = absent
+	}
+}
+
+func printNotSeen(a scanner.Absence) {
+	if a.LastSeen.IsZero() {
+		println(a.Device.Name, "not seen")
+		return
+	}
+	println(a.Device.Name, "not seen since", a.LastSeen.Format(time.DateTime))
+}
+
+// lockedEncoder serializes the output of the scan handler and reportNotSeen, which run concurrently.
+type lockedEncoder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (e *lockedEncoder) Encode(v any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(v)
+}
+
+func jsonNotSeen(enc *lockedEncoder) func(scanner.Absence) {
+	return func(a scanner.Absence) {
+		out := scanEvent{
+			Time: time.Now(),
+			Type: "notseen",
+			Name: a.Device.Name,
+		}
+		if !a.LastSeen.IsZero() {
+			out.LastSeen = &a.LastSeen
+		}
+		if err := enc.Encode(out); err != nil {
+			println("failed to write event:", err.Error())
+		}
+	}
+}
+
+func printEvent(verboseFlag *bool) scanner.Handler {
+	return func(event scanner.Event) {
+		adv := event.Advertisement
+		switch {
+		case event.Type == scanner.EventUnregistered:
+			println(adv.Address, adv.RSSI, "(unregistered)")
+		case event.Type == scanner.EventInvalid:
+			if *verboseFlag {
+				println(adv.Address, " - failed to parse data:", event.Err.Error(), hex.EncodeToString(event.Data))
+			}
+		case event.Device != nil:
+			println(adv.Address, adv.RSSI, event.Device.Name, event.KeyHex(), "- battery", findmy.BatteryStatus(event.Status))
+		default:
+			println(adv.Address, adv.RSSI, event.KeyHex(), "- battery", findmy.BatteryStatus(event.Status))
+		}
+	}
+}
+
+func jsonEvent(enc *lockedEncoder) scanner.Handler {
+	return func(event scanner.Event) {
+		adv := event.Advertisement
+		out := scanEvent{
+			Time:    adv.Time,
+			Address: adv.Address,
+			RSSI:    adv.RSSI,
+		}
+		switch event.Type {
+		case scanner.EventUnregistered:
+			out.Type = "unregistered"
+		case scanner.EventInvalid:
+			out.Type = "invalid"
+			out.Error = event.Err.Error()
+		default:
+			out.Type = "findmy"
+			out.Key = event.KeyHex()
+			out.Status = &event.Status
+			out.Battery = findmy.BatteryStatus(event.Status)
+			if event.Device != nil {
+				out.Name = event.Device.Name
+			}
+		}
+		if err := enc.Encode(out); err != nil {
+			println("failed to write event:", err.Error())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/web"
+)
+
+func serveMap(args []string, dir string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "Address to listen on")
+	keys := flags.String("keys", "", "A .keys file or a directory of .keys files to show, instead of the devices in the registry")
+	endpoint := flags.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
+	days := flags.Int("days", 7, "Number of days to retrieve reports for")
+	historyFile := flags.String("history", "", "File to keep the location history in, only the last retrieved reports are shown without it")
+	refresh := flags.Duration("refresh", web.DefaultRefresh, "Interval reports are retrieved at")
+	timeout := flags.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
+	tiles := flags.String("tiles", web.DefaultTileURL, "URL template of the map tiles")
+	attribution := flags.String("attribution", web.DefaultAttribution, "Attribution of the map tiles")
+	flags.Parse(args)
+
+	var devices []device.Device
+	var err error
+	if *keys != "" {
+		devices, err = loadDevices(*keys)
+	} else {
+		var registry *device.Registry
+		if registry, err = openRegistry(dir); err == nil {
+			devices, err = registry.List()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices to show, create one with 'haystack keys' or use -keys")
+	}
+
+	var store *history.Store
+	if *historyFile != "" {
+		if store, err = history.Open(*historyFile); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := reports.NewClient(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
+	s := web.New(web.Config{
+		Devices:     devices,
+		Get:         client.GetFn(ctx),
+		Store:       store,
+		Refresh:     *refresh,
+		TileURL:     *tiles,
+		Attribution: *attribution,
+	})
+	go s.Run(ctx)
+
+	server := &http.Server{Addr: *addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving map", "url", "http://"+*addr, "devices", len(devices))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/notify"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/watch"
+)
+
+// watchEvent is a single line of the JSON watch output.
+type watchEvent struct {
+	Device     string    `json:"device"`
+	DeviceID   string    `json:"deviceId"`
+	Published  time.Time `json:"published"`
+	Timestamp  time.Time `json:"timestamp"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Accuracy   uint8     `json:"accuracy"`
+	Confidence uint8     `json:"confidence"`
+	Battery    string    `json:"battery"`
+}
+
+func runWatch(args []string, dir string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	keys := flags.String("keys", "", "A .keys file or a directory of .keys files to watch, instead of the devices in the registry")
+	endpoint := flags.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
+	days := flags.Int("days", 7, "Number of days to retrieve reports for on the first poll")
+	interval := flags.Duration("interval", watch.DefaultInterval, "Interval reports are retrieved at")
+	maxBackoff := flags.Duration("max-backoff", watch.DefaultMaxBackoff, "Maximum delay between retries while the server fails")
+	timeout := flags.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
+	historyFile := flags.String("history", "", "File to store the reports in, reports already in it are not emitted again")
+	format := flags.String("format", "text", "Output format of new reports: text, json (one report per line) or none")
+	notifyFile := flags.String("notify", "", "JSON file with the notifiers to send new reports to, by name")
+	addr := flags.String("addr", "localhost:9477", "Address to serve /healthz and /metrics on, empty to disable")
+	flags.Parse(args)
+
+	var output func(d *device.Device, r reports.Report)
+	switch *format {
+	case "text":
+		output = func(d *device.Device, r reports.Report) {
+			fmt.Printf("%s %s %f,%f ±%dm battery %s\n", r.Data.Timestamp.Local().Format(time.DateTime), d.Name,
+				r.Data.Latitude, r.Data.Longitude, r.Data.AccuracyMeters, findmy.BatteryStatus(r.Data.Status))
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		output = func(d *device.Device, r reports.Report) {
+			if err := enc.Encode(watchEvent{
+				Device:     d.Name,
+				DeviceID:   d.ID,
+				Published:  r.DatePublished,
+				Timestamp:  r.Data.Timestamp,
+				Latitude:   r.Data.Latitude,
+				Longitude:  r.Data.Longitude,
+				Accuracy:   r.Data.AccuracyMeters,
+				Confidence: r.Data.ConfidencePercent,
+				Battery:    findmy.BatteryStatus(r.Data.Status),
+			}); err != nil {
+				slog.Error("failed to write report", "error", err)
+			}
+		}
+	case "none":
+		output = func(*device.Device, reports.Report) {}
+	default:
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+
+	notifiers, err := loadNotifiers(*notifyFile)
+	if err != nil {
+		return err
+	}
+
+	var devices []device.Device
+	if *keys != "" {
+		devices, err = loadDevices(*keys)
+	} else {
+		var registry *device.Registry
+		if registry, err = openRegistry(dir); err == nil {
+			devices, err = registry.List()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices to watch, create one with 'haystack keys' or use -keys")
+	}
+
+	var store *history.Store
+	if *historyFile != "" {
+		if store, err = history.Open(*historyFile); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := reports.NewClient(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
+	// battery is the battery status of the last report of each device, to notify when it gets low
+	battery := map[string]string{}
+	w := watch.New(watch.Config{
+		Devices:    devices,
+		Fetch:      client.GetSince,
+		Interval:   *interval,
+		MaxBackoff: *maxBackoff,
+		OnReports: func(ctx context.Context, b watch.Batch) {
+			d := b.Device
+			if store != nil {
+				if _, err := store.Add(reports.Reports{d.ID: b.Reports}); err != nil {
+					slog.Error("failed to store reports", "error", err)
+				}
+			}
+			for _, r := range b.Reports {
+				output(d, r)
+				status := findmy.BatteryStatus(r.Data.Status)
+				previous, known := battery[d.ID]
+				battery[d.ID] = status
+				// reports published before the watcher started are not sent, so restarts do not repeat them
+				if b.Initial {
+					continue
+				}
+				sendNotification(ctx, notifiers, reportMessage(d, r))
+				if (status == "low" || status == "critical") && known && previous != status {
+					m := reportMessage(d, r)
+					m.Kind = notify.LowBattery
+					m.Text = fmt.Sprintf("%s battery is %s", d.Name, status)
+					sendNotification(ctx, notifiers, m)
+				}
+			}
+		},
+	})
+
+	if store != nil {
+		ids := make([]string, 0, len(devices))
+		for _, d := range devices {
+			ids = append(ids, d.ID)
+		}
+		for id, rs := range store.Query(history.Query{DeviceIDs: ids}) {
+			for _, r := range rs {
+				w.SetNewest(id, r.DatePublished, r.Data.Timestamp)
+			}
+		}
+	}
+
+	if *addr != "" {
+		server := &http.Server{Addr: *addr, Handler: w.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("failed to serve metrics", "error", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	slog.Info("watching reports", "devices", len(devices), "interval", interval.String(), "metrics", *addr)
+	w.Run(ctx)
+	return nil
+}
+
+// loadNotifiers creates the notifiers of a JSON file mapping names to notify.Config.
+func loadNotifiers(fileName string) (map[string]notify.Notifier, error) {
+	notifiers := map[string]notify.Notifier{}
+	if fileName == "" {
+		return notifiers, nil
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+	var configs map[string]notify.Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse notifiers (%s): %w", fileName, err)
+	}
+	for name, config := range configs {
+		if notifiers[name], err = notify.New(config); err != nil {
+			return nil, fmt.Errorf("invalid notifier %s: %w", name, err)
+		}
+	}
+	return notifiers, nil
+}
+
+func reportMessage(d *device.Device, r reports.Report) notify.Message {
+	return notify.Message{
+		Kind:     notify.Report,
+		Device:   d.Name,
+		DeviceID: d.ID,
+		Text: fmt.Sprintf("%s reported at %s, ±%d m, battery %s", d.Name, r.Data.Timestamp.Local().Format(time.DateTime),
+			r.Data.AccuracyMeters, findmy.BatteryStatus(r.Data.Status)),
+		Time:     r.Data.Timestamp,
+		Location: &notify.Location{Latitude: r.Data.Latitude, Longitude: r.Data.Longitude, Accuracy: float64(r.Data.AccuracyMeters)},
+	}
+}
+
+// sendNotification sends the message to all notifiers.
+func sendNotification(ctx context.Context, notifiers map[string]notify.Notifier, m notify.Message) {
+	for name, n := range notifiers {
+		if err := n.Notify(ctx, m); err != nil {
+			slog.Error("failed to notify", "notifier", name, "device", m.Device, "error", err)
+		}
+	}
+}
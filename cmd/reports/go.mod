@@ -3,3 +3,21 @@ module github.com/HattoriHanzo031/go-haystack/cmd/reports
 go 1.23.5
 
 require github.com/HattoriHanzo031/go-haystack v0.0.2
+
+require (
+	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/saltosystems/winrt-go v0.0.0-20241223121953-98e32661f6ff // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	github.com/soypat/cyw43439 v0.0.0-20250106095300-90bf0c1db251 // indirect
+	github.com/soypat/seqs v0.0.0-20250124201400-0d65bc7c1710 // indirect
+	github.com/tinygo-org/cbgo v0.0.4 // indirect
+	github.com/tinygo-org/pio v0.0.0-20241219082822-57ca4e0dc776 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/exp v0.0.0-20250128182459-e0ece0dbea4c // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/term v0.28.0 // indirect
+	tinygo.org/x/bluetooth v0.10.0 // indirect
+)
+
+replace github.com/HattoriHanzo031/go-haystack => ../..
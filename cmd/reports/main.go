@@ -1,26 +1,40 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 
 	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/export"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/locate"
 	"github.com/HattoriHanzo031/go-haystack/lib/reports"
 )
 
 func main() {
 	endpoint := flag.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
 	days := flag.Int("days", 7, "Number of days to retrieve reports for")
+	historyFile := flag.String("history", "", "File to keep the location history in, all stored reports are printed when set")
+	format := flag.String("format", "json", "Output format: json, gpx, kml, geojson or estimate (the estimated current location of each device)")
+	timeout := flag.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "Set HAYSTACK_TOKEN or HAYSTACK_USERNAME and HAYSTACK_PASSWORD to authenticate to the server.\n")
 	}
 	flag.Parse()
+	if *format != "json" && *format != "estimate" && !slices.Contains(export.Formats, export.Format(*format)) {
+		log.Fatal("unsupported format: ", *format)
+	}
 
 	devices := []device.Device{}
 	for _, deviceFile := range flag.Args() {
@@ -31,23 +45,62 @@ func main() {
 		devices = append(devices, *device)
 	}
 
-	if err := run(reports.GetFn(*endpoint, *days), devices); err != nil {
+	var store *history.Store
+	if *historyFile != "" {
+		var err error
+		if store, err = history.Open(*historyFile); err != nil {
+			log.Fatal("failed to open history:", err)
+		}
+		defer store.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := reports.NewClient(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
+	if err := run(client.GetFn(ctx), devices, store, *format); err != nil {
 		log.Fatal("failed to run:", err)
 	}
 }
 
-func run(getReports reports.Get, devices []device.Device) error {
+func run(getReports reports.Get, devices []device.Device, store *history.Store, format string) error {
 	deviceReports, err := getReports(devices)
 	if err != nil {
 		e := reports.NonFatalError{}
 		if errors.As(err, &e) {
-			fmt.Println("reports retrieved with errors:", e)
+			fmt.Fprintln(os.Stderr, "reports retrieved with errors:", e)
 		} else {
 			return fmt.Errorf("failed to get reports: %w", err)
 		}
 	}
 
-	out, _ := json.MarshalIndent(deviceReports, "", "\t")
+	if store != nil {
+		if _, err := store.Add(deviceReports); err != nil {
+			return fmt.Errorf("failed to store reports: %w", err)
+		}
+		ids := make([]string, 0, len(devices))
+		for _, d := range devices {
+			ids = append(ids, d.ID)
+		}
+		deviceReports = store.Query(history.Query{DeviceIDs: ids})
+	}
+
+	var output any = deviceReports
+	switch format {
+	case "json":
+	case "estimate":
+		estimates := map[string]locate.Estimate{}
+		for _, d := range devices {
+			if e, ok := locate.Best(deviceReports[d.ID], locate.Config{}); ok {
+				estimates[d.ID] = e
+			}
+		}
+		output = estimates
+	default:
+		return export.Write(os.Stdout, export.Format(format), devices, deviceReports)
+	}
+
+	out, _ := json.MarshalIndent(output, "", "\t")
 	fmt.Println(string(out))
 	return nil
 }
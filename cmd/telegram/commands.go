@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/export"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/locate"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// defaultHistory is the number of hours /history shows without an argument.
+	defaultHistory = 24
+	// maxVenues is the maximum number of locations /history sends as messages.
+	maxVenues = 10
+	// maxCallbackData is the maximum length of the data of an inline keyboard button.
+	maxCallbackData = 64
+)
+
+// botCommands are registered with Telegram, so clients suggest them.
+var botCommands = []tgbotapi.BotCommand{
+	{Command: "locate", Description: "Estimated current location of a device"},
+	{Command: "history", Description: "Track of a device, NAME [hours]"},
+	{Command: "battery", Description: "Last known battery status"},
+	{Command: "subscribe", Description: "Send new locations of a device"},
+	{Command: "unsubscribe", Description: "Stop sending new locations of a device"},
+}
+
+// commands implements the bot commands.
+type commands struct {
+	getReports reports.Get
+	devices    []device.Device
+	subs       *subscriptions
+}
+
+func (c *commands) handlers() map[string]func(bot *tgbotapi.BotAPI, req request) error {
+	return map[string]func(bot *tgbotapi.BotAPI, req request) error{
+		"locate":      c.locate,
+		"history":     c.history,
+		"battery":     c.battery,
+		"subscribe":   c.subscribe,
+		"unsubscribe": c.unsubscribe,
+	}
+}
+
+// selectDevices returns the devices selected by the argument, a device name or ID, or all devices for "all"
+// if allowAll is set. Without an argument it sends a keyboard to pick one of the devices, which repeats the
+// command with the device and suffix as arguments, and returns nil.
+func selectDevices(bot *tgbotapi.BotAPI, req request, command, suffix string, candidates []device.Device, allowAll bool) ([]device.Device, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("no devices")
+	}
+	if req.args == "" {
+		if len(candidates) == 1 {
+			return candidates, nil
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, d := range candidates {
+			data := command + " " + d.Name + suffix
+			if len(data) > maxCallbackData {
+				data = command + " " + d.ID + suffix
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(d.Name, data)))
+		}
+		if allowAll {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("All", command+" all"+suffix)))
+		}
+		msg := tgbotapi.NewMessage(req.chat.ID, "Choose a device")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		_, err := bot.Send(msg)
+		return nil, err
+	}
+
+	if allowAll && strings.EqualFold(req.args, "all") {
+		return candidates, nil
+	}
+	i := slices.IndexFunc(candidates, func(d device.Device) bool {
+		return strings.EqualFold(d.Name, req.args) || d.ID == req.args
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("device(s) %s not found", req.args)
+	}
+	return candidates[i : i+1], nil
+}
+
+// latestReports retrieves the reports of the devices, ordered by location timestamp.
+func (c *commands) latestReports(devices []device.Device) (reports.Reports, error) {
+	deviceReports, err := c.getReports(devices)
+	if err != nil {
+		e := reports.NonFatalError{}
+		if errors.As(err, &e) {
+			log.Println("reports retrieved with errors:", e)
+		} else {
+			return nil, fmt.Errorf("failed to get reports: %w", err)
+		}
+	}
+	for _, rs := range deviceReports {
+		slices.SortFunc(rs, func(i, j reports.Report) int {
+			return i.Data.Timestamp.Compare(j.Data.Timestamp)
+		})
+	}
+	return deviceReports, nil
+}
+
+func (c *commands) locate(bot *tgbotapi.BotAPI, req request) error {
+	if req.args == "" {
+		req.args = "all"
+	}
+	locateDevices, err := selectDevices(bot, req, "locate", "", req.chat.visible(c.devices), true)
+	if err != nil || locateDevices == nil {
+		return err
+	}
+
+	deviceReports, err := c.latestReports(locateDevices)
+	if err != nil {
+		return err
+	}
+	if len(deviceReports) == 0 {
+		return fmt.Errorf("No reports found")
+	}
+
+	for _, d := range locateDevices {
+		estimate, ok := locate.Best(deviceReports[d.ID], locate.Config{})
+		if !ok {
+			fmt.Println("No reports found for device", d.Name)
+			continue
+		}
+		if err := sendEstimate(bot, req.chat.ID, d.Name, estimate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *commands) history(bot *tgbotapi.BotAPI, req request) error {
+	hours := defaultHistory
+	if parsed, err := strconv.Atoi(req.args); err == nil && parsed > 0 {
+		req.args, hours = "", parsed
+	} else if name, h, found := cutLast(req.args); found {
+		if parsed, err := strconv.Atoi(h); err == nil && parsed > 0 {
+			req.args, hours = name, parsed
+		}
+	}
+	selected, err := selectDevices(bot, req, "history", " "+strconv.Itoa(hours), req.chat.visible(c.devices), false)
+	if err != nil || selected == nil {
+		return err
+	}
+	d := selected[0]
+
+	deviceReports, err := c.latestReports(selected)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	rs := slices.DeleteFunc(deviceReports[d.ID], func(r reports.Report) bool {
+		return r.Data.Timestamp.Before(since)
+	})
+	if len(rs) == 0 {
+		_, err := bot.Send(tgbotapi.NewMessage(req.chat.ID, fmt.Sprintf("No reports for %s in the last %d hours", d.Name, hours)))
+		return err
+	}
+
+	summary := fmt.Sprintf("[%s]: %d reports in the last %d hours, from %s to %s", d.Name, len(rs), hours,
+		rs[0].Data.Timestamp.Local().Format(time.DateTime), rs[len(rs)-1].Data.Timestamp.Local().Format(time.DateTime))
+	if _, err := bot.Send(tgbotapi.NewMessage(req.chat.ID, summary)); err != nil {
+		return fmt.Errorf("Failed to send history: %w", err)
+	}
+
+	// an evenly spaced selection of the locations, always including the last one
+	step := max(1, (len(rs)+maxVenues-1)/maxVenues)
+	for i := (len(rs) - 1) % step; i < len(rs); i += step {
+		r := rs[i]
+		venue := tgbotapi.NewVenue(req.chat.ID, r.Data.Timestamp.Local().Format(time.DateTime),
+			fmt.Sprintf("±%d m, battery %s", r.Data.AccuracyMeters, findmy.BatteryStatus(r.Data.Status)),
+			r.Data.Latitude, r.Data.Longitude)
+		if _, err := bot.Send(venue); err != nil {
+			return fmt.Errorf("Failed to send location: %w", err)
+		}
+	}
+
+	var gpx bytes.Buffer
+	if err := export.WriteGPX(&gpx, selected, reports.Reports{d.ID: rs}); err != nil {
+		return err
+	}
+	doc := tgbotapi.NewDocument(req.chat.ID, tgbotapi.FileBytes{Name: d.Name + ".gpx", Bytes: gpx.Bytes()})
+	if _, err := bot.Send(doc); err != nil {
+		return fmt.Errorf("Failed to send track: %w", err)
+	}
+	return nil
+}
+
+func (c *commands) battery(bot *tgbotapi.BotAPI, req request) error {
+	if req.args == "" {
+		req.args = "all"
+	}
+	selected, err := selectDevices(bot, req, "battery", "", req.chat.visible(c.devices), true)
+	if err != nil || selected == nil {
+		return err
+	}
+
+	deviceReports, err := c.latestReports(selected)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, d := range selected {
+		rs := deviceReports[d.ID]
+		if len(rs) == 0 {
+			lines = append(lines, fmt.Sprintf("[%s]: no reports", d.Name))
+			continue
+		}
+		r := rs[len(rs)-1]
+		lines = append(lines, fmt.Sprintf("[%s]: battery %s, reported %s", d.Name,
+			findmy.BatteryStatus(r.Data.Status), r.Data.Timestamp.Local().Format(time.DateTime)))
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(req.chat.ID, strings.Join(lines, "\n")))
+	return err
+}
+
+func (c *commands) subscribe(bot *tgbotapi.BotAPI, req request) error {
+	selected, err := selectDevices(bot, req, "subscribe", "", req.chat.visible(c.devices), true)
+	if err != nil || selected == nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(selected))
+	names := make([]string, 0, len(selected))
+	for _, d := range selected {
+		ids = append(ids, d.ID)
+		names = append(names, d.Name)
+	}
+	if err := c.subs.add(req.chat.ID, time.Now(), ids...); err != nil {
+		return fmt.Errorf("failed to save subscriptions: %w", err)
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(req.chat.ID, "Subscribed to "+strings.Join(names, ", ")))
+	return err
+}
+
+func (c *commands) unsubscribe(bot *tgbotapi.BotAPI, req request) error {
+	subscribed := c.subs.devices(req.chat.ID)
+	candidates := slices.DeleteFunc(slices.Clone(c.devices), func(d device.Device) bool {
+		return !slices.Contains(subscribed, d.ID)
+	})
+	if len(candidates) == 0 {
+		_, err := bot.Send(tgbotapi.NewMessage(req.chat.ID, "Not subscribed to any device"))
+		return err
+	}
+	selected, err := selectDevices(bot, req, "unsubscribe", "", candidates, true)
+	if err != nil || selected == nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(selected))
+	names := make([]string, 0, len(selected))
+	for _, d := range selected {
+		ids = append(ids, d.ID)
+		names = append(names, d.Name)
+	}
+	if err := c.subs.remove(req.chat.ID, ids...); err != nil {
+		return fmt.Errorf("failed to save subscriptions: %w", err)
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(req.chat.ID, "Unsubscribed from "+strings.Join(names, ", ")))
+	return err
+}
+
+// poll sends the reports published since the last poll to the chats subscribed to the devices.
+func (c *commands) poll(bot *tgbotapi.BotAPI) {
+	ids := c.subs.subscribed()
+	devices := slices.DeleteFunc(slices.Clone(c.devices), func(d device.Device) bool {
+		return !slices.Contains(ids, d.ID)
+	})
+	if len(devices) == 0 {
+		return
+	}
+
+	deviceReports, err := c.latestReports(devices)
+	if err != nil {
+		log.Println("failed to poll reports:", err)
+		return
+	}
+	for _, d := range devices {
+		rs := deviceReports[d.ID]
+		var newest time.Time
+		for _, r := range rs {
+			if r.DatePublished.After(newest) {
+				newest = r.DatePublished
+			}
+		}
+		previous, ok, err := c.subs.advance(d.ID, newest)
+		if err != nil {
+			log.Println("failed to save subscriptions:", err)
+		}
+		if !ok {
+			continue
+		}
+		for _, r := range rs {
+			if !r.DatePublished.After(previous) {
+				continue
+			}
+			for _, chatID := range c.subs.subscribers(d.ID) {
+				if err := sendReport(bot, chatID, d.Name, r); err != nil {
+					log.Printf("failed to send report of %s to chat %d: %v", d.Name, chatID, err)
+				}
+			}
+		}
+	}
+}
+
+// sendReport sends the location of the report and a message with its time, battery status and accuracy.
+func sendReport(bot *tgbotapi.BotAPI, chatID int64, name string, report reports.Report) error {
+	msg := tgbotapi.NewLocation(chatID, report.Data.Latitude, report.Data.Longitude)
+	if _, err := bot.Send(msg); err != nil {
+		return fmt.Errorf("Failed to send location: %w", err)
+	}
+	text := fmt.Sprintf("[%s]: %s, battery %s, ±%d m", name, report.Data.Timestamp.Local().Format(time.DateTime),
+		findmy.BatteryStatus(report.Data.Status), report.Data.AccuracyMeters)
+	if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		return fmt.Errorf("Failed to send timestamp: %w", err)
+	}
+	return nil
+}
+
+// sendEstimate sends the estimated location and a message with the time and battery status of the newest
+// report used, and the uncertainty of the estimate.
+func sendEstimate(bot *tgbotapi.BotAPI, chatID int64, name string, estimate locate.Estimate) error {
+	msg := tgbotapi.NewLocation(chatID, estimate.Latitude, estimate.Longitude)
+	if _, err := bot.Send(msg); err != nil {
+		return fmt.Errorf("Failed to send location: %w", err)
+	}
+	text := fmt.Sprintf("[%s]: %s, battery %s, ±%.0f m from %d report(s)", name, estimate.To.Local().Format(time.DateTime),
+		findmy.BatteryStatus(estimate.Latest.Data.Status), estimate.Radius, estimate.Reports)
+	if _, err := bot.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		return fmt.Errorf("Failed to send timestamp: %w", err)
+	}
+	return nil
+}
+
+// cutLast splits s at the last space.
+func cutLast(s string) (before, after string, found bool) {
+	i := strings.LastIndexByte(s, ' ')
+	if i < 0 {
+		return s, "", false
+	}
+	return strings.TrimSpace(s[:i]), s[i+1:], true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+// Config is the bot configuration file:
+//
+//	{
+//		"keys": ["/home/me/.config/haystack"],
+//		"chats": [
+//			{"id": 1799333354, "name": "me"},
+//			{"id": -1001234567890, "name": "family", "users": [1799333354, 5550123], "devices": ["bag", "keys"]}
+//		]
+//	}
+//
+// Commands are only accepted in the listed chats.
+type Config struct {
+	// Keys are .keys files or directories of .keys files, in addition to the files given as arguments.
+	Keys  []string     `json:"keys,omitempty"`
+	Chats []ChatConfig `json:"chats"`
+}
+
+// ChatConfig authorizes a chat to use the bot.
+type ChatConfig struct {
+	// ID is the ID of the private chat with a user or of a group.
+	ID   int64  `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Users limits the users that may send commands in the chat, all members of the chat if empty.
+	Users []int64 `json:"users,omitempty"`
+	// Devices are the names of the devices the chat may locate, all devices if empty.
+	Devices []string `json:"devices,omitempty"`
+}
+
+func loadConfig(fileName string) (*Config, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse config (%s): %w", fileName, err)
+	}
+
+	if len(c.Chats) == 0 {
+		return nil, errors.New("no chats in config")
+	}
+	seen := map[int64]bool{}
+	for _, chat := range c.Chats {
+		if chat.ID == 0 {
+			return nil, errors.New("chat without id in config")
+		}
+		if seen[chat.ID] {
+			return nil, fmt.Errorf("duplicate chat %d in config", chat.ID)
+		}
+		seen[chat.ID] = true
+	}
+	return &c, nil
+}
+
+// checkDevices checks that the chats only refer to loaded devices.
+func (c *Config) checkDevices(devices []device.Device) error {
+	for _, chat := range c.Chats {
+		for _, name := range chat.Devices {
+			if !slices.ContainsFunc(devices, func(d device.Device) bool { return d.Name == name }) {
+				return fmt.Errorf("unknown device %s for chat %d", name, chat.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// authorize returns the configuration of the chat if the user may send commands in it.
+func (c *Config) authorize(chatID, userID int64) (*ChatConfig, bool) {
+	chat := c.chat(chatID)
+	if chat == nil || len(chat.Users) > 0 && !slices.Contains(chat.Users, userID) {
+		return nil, false
+	}
+	return chat, true
+}
+
+// chat returns the configuration of the chat, nil if it is not in the config.
+func (c *Config) chat(chatID int64) *ChatConfig {
+	for i := range c.Chats {
+		if c.Chats[i].ID == chatID {
+			return &c.Chats[i]
+		}
+	}
+	return nil
+}
+
+// visible returns the devices the chat may locate.
+func (chat *ChatConfig) visible(devices []device.Device) []device.Device {
+	if len(chat.Devices) == 0 {
+		return devices
+	}
+	var result []device.Device
+	for _, d := range devices {
+		if slices.Contains(chat.Devices, d.Name) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+var testConfig = &Config{
+	Chats: []ChatConfig{
+		{ID: 1, Name: "me"},
+		{ID: -2, Name: "family", Users: []int64{10, 11}, Devices: []string{"bag", "keys"}},
+	},
+}
+
+func message(chatID, userID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: chatID},
+		From: &tgbotapi.User{ID: userID},
+		Text: text,
+	}}
+}
+
+func callback(chatID, userID int64, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: userID},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}},
+		Data:    data,
+	}}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		// chat is the ID of the authorized chat, 0 if the update is ignored
+		chat int64
+	}{
+		{"private chat", message(1, 99, "/locate"), 1},
+		{"allowed user in group", message(-2, 10, "/locate"), -2},
+		{"other allowed user in group", message(-2, 11, "/locate"), -2},
+		{"user not allowed in group", message(-2, 12, "/locate"), 0},
+		{"unknown chat", message(3, 10, "/locate"), 0},
+		{"message without sender in group", tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -2}}}, 0},
+		{"callback in private chat", callback(1, 99, "/locate bag"), 1},
+		{"callback of allowed user in group", callback(-2, 10, "/locate bag"), -2},
+		{"callback of user not allowed in group", callback(-2, 12, "/locate bag"), 0},
+		{"callback in unknown chat", callback(3, 10, "/locate bag"), 0},
+		{"callback on unknown message", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 10}, Data: "/locate bag"}}, 0},
+		{"other update", tgbotapi.Update{EditedMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}}}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got int64
+			if chatID, userID, _, ok := sender(test.update); ok {
+				if chat, ok := testConfig.authorize(chatID, userID); ok {
+					got = chat.ID
+				}
+			}
+			if got != test.chat {
+				t.Errorf("authorized chat %d, want %d", got, test.chat)
+			}
+		})
+	}
+}
+
+func TestSenderText(t *testing.T) {
+	if _, _, text, _ := sender(message(1, 99, "/locate")); text != "/locate" {
+		t.Errorf("message text %q, want /locate", text)
+	}
+	if _, _, text, _ := sender(callback(1, 99, "/locate bag")); text != "/locate bag" {
+		t.Errorf("callback text %q, want /locate bag", text)
+	}
+}
+
+func TestVisible(t *testing.T) {
+	devices := []device.Device{{Name: "bag"}, {Name: "keys"}, {Name: "wallet"}}
+
+	tests := []struct {
+		chat int64
+		want []string
+	}{
+		{1, []string{"bag", "keys", "wallet"}},
+		{-2, []string{"bag", "keys"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, d := range testConfig.chat(test.chat).visible(devices) {
+			got = append(got, d.Name)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("chat %d sees %v, want %v", test.chat, got, test.want)
+		}
+	}
+}
+
+func TestCheckDevices(t *testing.T) {
+	if err := testConfig.checkDevices([]device.Device{{Name: "bag"}, {Name: "keys"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := testConfig.checkDevices([]device.Device{{Name: "bag"}}); err == nil {
+		t.Error("expected error for unknown device keys")
+	}
+}
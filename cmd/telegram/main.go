@@ -1,13 +1,13 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"slices"
 	"strings"
+	"time"
 
 	"github.com/HattoriHanzo031/go-haystack/lib/device"
 	"github.com/HattoriHanzo031/go-haystack/lib/reports"
@@ -15,7 +15,6 @@ import (
 )
 
 func main() {
-	chatID := int64(1799333354)
 	botApiToken, ok := os.LookupEnv("TELEGRAM_API_TOKEN")
 	if !ok {
 		log.Fatalf("TELEGRAM_API_TOKEN environment variable not set")
@@ -24,22 +23,43 @@ func main() {
 	endpoint := flag.String("endpoint", "http://localhost:6176", "Address of the macless-haystack server")
 	days := flag.Int("days", 7, "Number of days to retrieve reports for")
 	debug := flag.Bool("debug", false, "Enable debug mode")
+	timeout := flag.Duration("timeout", reports.DefaultTimeout, "Timeout of requests to the macless-haystack server")
+	configFile := flag.String("config", "telegram.json", "Configuration file with the chats allowed to use the bot")
+	subscriptionsFile := flag.String("subscriptions", "", "File to keep the subscriptions in, they are lost on restart without it")
+	pollInterval := flag.Duration("poll", 15*time.Minute, "Interval new reports of subscribed devices are retrieved at")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [keys files]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "Set HAYSTACK_TOKEN or HAYSTACK_USERNAME and HAYSTACK_PASSWORD to authenticate to the server.\n")
 	}
 	flag.Parse()
 
-	getReports := reports.GetFn(*endpoint, *days)
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	getReports := reports.GetFn(*endpoint, *days, reports.WithHTTPClient(&http.Client{Timeout: *timeout}), reports.AuthFromEnv())
 	devices := []device.Device{}
-	for _, deviceFile := range flag.Args() {
-		device, err := device.LoadFromFile(deviceFile)
+	for _, path := range append(config.Keys, flag.Args()...) {
+		loaded, err := loadDevices(path)
 		if err != nil {
 			log.Fatalf("failed to load device: %v", err)
 		}
-		devices = append(devices, *device)
+		devices = append(devices, loaded...)
+	}
+	if err := config.checkDevices(devices); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	subs, err := loadSubscriptions(*subscriptionsFile)
+	if err != nil {
+		log.Fatalf("failed to load subscriptions: %v", err)
+	}
+	if err := subs.prune(config, devices); err != nil {
+		log.Fatalf("failed to save subscriptions: %v", err)
 	}
 
 	bot, err := tgbotapi.NewBotAPI(botApiToken)
@@ -49,82 +69,105 @@ func main() {
 
 	// Set debug mode for development
 	bot.Debug = *debug
-	run(bot, chatID, getReports, devices)
+	run(bot, config, getReports, devices, subs, *pollInterval)
 }
 
-func run(bot *tgbotapi.BotAPI, chatID int64, getReports reports.Get, devices []device.Device) {
-	deviceNames := make(map[string]device.Device, len(devices))
-	deviceIDs := make(map[string]device.Device, len(devices))
-	for _, d := range devices {
-		deviceNames[d.Name] = d
-		deviceIDs[d.ID] = d
+// loadDevices loads a single .keys file or all .keys files in a directory.
+func loadDevices(path string) ([]device.Device, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
 	}
+	if info.IsDir() {
+		return device.LoadFromDir(path)
+	}
+	d, err := device.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []device.Device{*d}, nil
+}
 
-	handleMessages(bot, chatID, map[string]func(bot *tgbotapi.BotAPI, args string) error{
-		"locate": func(bot *tgbotapi.BotAPI, args string) error {
-			locateDevices := []device.Device{}
-			if args == "" || args == "all" {
-				locateDevices = devices
-			} else if device, ok := deviceNames[args]; ok {
-				locateDevices = append(locateDevices, device)
-			} else {
-				return fmt.Errorf("device(s) %s not found", args)
-			}
+// request is a command received in an authorized chat.
+type request struct {
+	chat *ChatConfig
+	args string
+}
 
-			deviceReports, err := getReports(locateDevices)
-			if err != nil {
-				e := reports.NonFatalError{}
-				if errors.As(err, &e) {
-					fmt.Println("reports retrieved with errors:", e)
-				} else {
-					return fmt.Errorf("failed to get reports: %w", err)
-				}
-			}
-			if len(deviceReports) == 0 {
-				return fmt.Errorf("No reports found")
-			}
+func run(bot *tgbotapi.BotAPI, config *Config, getReports reports.Get, devices []device.Device, subs *subscriptions, pollInterval time.Duration) {
+	c := &commands{getReports: getReports, devices: devices, subs: subs}
 
-			for id, deviceReport := range deviceReports {
-				if len(deviceReport) == 0 {
-					fmt.Println("No reports found for device", deviceIDs[id].Name)
-					continue
-				}
-				slices.SortFunc(deviceReport, func(i, j reports.Report) int {
-					return i.Data.Timestamp.Compare(j.Data.Timestamp)
-				})
-
-				report := deviceReport[len(deviceReport)-1]
-				msg := tgbotapi.NewLocation(chatID, report.Data.Latitude, report.Data.Longitude)
-				if _, err = bot.Send(msg); err != nil {
-					return fmt.Errorf("Failed to send location: %w", err)
-				}
-				if _, err = bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("[%s]: %s", deviceIDs[id].Name, report.Data.Timestamp))); err != nil {
-					return fmt.Errorf("Failed to send timestamp: %w", err)
-				}
-			}
-			return nil
-		},
-	})
+	if _, err := bot.Request(tgbotapi.NewSetMyCommands(botCommands...)); err != nil {
+		log.Println("failed to register commands:", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			c.poll(bot)
+			<-ticker.C
+		}
+	}()
+
+	handleMessages(bot, config, c.handlers())
 }
 
-func handleMessages(bot *tgbotapi.BotAPI /*TODO: logger*/, chatID int64, handlers map[string]func(bot *tgbotapi.BotAPI, args string) error) {
+func handleMessages(bot *tgbotapi.BotAPI /*TODO: logger*/, config *Config, handlers map[string]func(bot *tgbotapi.BotAPI, req request) error) {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
 	updates := bot.GetUpdatesChan(u)
 
 	for update := range updates {
-		if update.Message == nil {
+		chatID, userID, text, ok := sender(update)
+		if !ok {
+			continue
+		}
+		if update.CallbackQuery != nil {
+			_, _ = bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, ""))
+		}
+
+		chat, ok := config.authorize(chatID, userID)
+		if !ok {
+			log.Printf("ignoring message from unauthorized user %d in chat %d", userID, chatID)
 			continue
 		}
+		if update.CallbackQuery != nil {
+			// replace the keyboard with the choice, so it is not used again
+			_, _ = bot.Request(tgbotapi.NewEditMessageText(chatID, update.CallbackQuery.Message.MessageID, text))
+		}
 
-		command, args, _ := strings.Cut(update.Message.Text, " ")
-		if handler, ok := handlers[strings.ToLower(strings.TrimSpace(command))]; ok {
-			err := handler(bot, strings.ToLower(strings.TrimSpace(args)))
+		command, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+		// commands may be sent as /command or /command@botname
+		command, _, _ = strings.Cut(strings.TrimPrefix(command, "/"), "@")
+		if handler, ok := handlers[strings.ToLower(command)]; ok {
+			err := handler(bot, request{chat: chat, args: strings.TrimSpace(args)})
 			if err != nil {
-				fmt.Printf("Failed to handle command %s: %v", command, err) // TODO: logger
+				log.Printf("failed to handle command %s: %v", command, err)
 				_, _ = bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Failed to handle command %s: %v", command, err)))
 			}
 		}
 	}
 }
+
+// sender returns the chat and user an update was sent from and the command text it carries,
+// false if the update carries no command.
+func sender(update tgbotapi.Update) (chatID, userID int64, text string, ok bool) {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		if update.Message.From != nil {
+			userID = update.Message.From.ID
+		}
+		return update.Message.Chat.ID, userID, update.Message.Text, true
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		// a device picked on an inline keyboard, the button data is the command to run
+		query := update.CallbackQuery
+		if query.From != nil {
+			userID = query.From.ID
+		}
+		return query.Message.Chat.ID, userID, query.Data, true
+	default:
+		return 0, 0, "", false
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+// subscriptions are the devices each chat receives new reports of.
+// They are saved to a file, if set, so they survive restarts.
+type subscriptions struct {
+	mu       sync.Mutex
+	fileName string
+	chats    map[int64][]string
+	// published is the publish time of the newest report sent for each device ID.
+	published map[string]time.Time
+}
+
+// subscriptionsFile is the content of the subscriptions file.
+type subscriptionsFile struct {
+	Chats     map[int64][]string   `json:"chats"`
+	Published map[string]time.Time `json:"published,omitempty"`
+}
+
+func loadSubscriptions(fileName string) (*subscriptions, error) {
+	s := &subscriptions{
+		fileName:  fileName,
+		chats:     make(map[int64][]string),
+		published: make(map[string]time.Time),
+	}
+	if fileName == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+	var file subscriptionsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions (%s): %w", fileName, err)
+	}
+	if file.Chats != nil {
+		s.chats = file.Chats
+	}
+	if file.Published != nil {
+		s.published = file.Published
+	}
+	return s, nil
+}
+
+func (s *subscriptions) save() error {
+	if s.fileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(subscriptionsFile{Chats: s.chats, Published: s.published}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.fileName, data, 0o600)
+}
+
+// prune removes the subscriptions of chats that are no longer in the config and to devices the chats may no longer locate.
+func (s *subscriptions) prune(config *Config, devices []device.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for chatID, ids := range s.chats {
+		chat := config.chat(chatID)
+		var visible []device.Device
+		if chat != nil {
+			visible = chat.visible(devices)
+		}
+		kept := slices.DeleteFunc(slices.Clone(ids), func(id string) bool {
+			return !slices.ContainsFunc(visible, func(d device.Device) bool { return d.ID == id })
+		})
+		if len(kept) == len(ids) {
+			continue
+		}
+		log.Printf("removed %d subscription(s) of chat %d that are no longer allowed", len(ids)-len(kept), chatID)
+		changed = true
+		if len(kept) == 0 {
+			delete(s.chats, chatID)
+		} else {
+			s.chats[chatID] = kept
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// add subscribes the chat to the devices. Devices without other subscribers, which are not polled,
+// start at the baseline, so the first poll sends the reports published after it.
+func (s *subscriptions) add(chatID int64, baseline time.Time, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if !s.hasSubscribers(id) {
+			s.published[id] = baseline
+		}
+		if !slices.Contains(s.chats[chatID], id) {
+			s.chats[chatID] = append(s.chats[chatID], id)
+		}
+	}
+	return s.save()
+}
+
+// hasSubscribers reports whether any chat is subscribed to the device. It must be called with mu held.
+func (s *subscriptions) hasSubscribers(id string) bool {
+	for _, ids := range s.chats {
+		if slices.Contains(ids, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove unsubscribes the chat from the devices.
+func (s *subscriptions) remove(chatID int64, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats[chatID] = slices.DeleteFunc(s.chats[chatID], func(id string) bool {
+		return slices.Contains(ids, id)
+	})
+	if len(s.chats[chatID]) == 0 {
+		delete(s.chats, chatID)
+	}
+	return s.save()
+}
+
+// devices returns the IDs of the devices the chat is subscribed to.
+func (s *subscriptions) devices(chatID int64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.chats[chatID])
+}
+
+// subscribed returns the IDs of all devices with subscribers.
+func (s *subscriptions) subscribed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, chatIDs := range s.chats {
+		for _, id := range chatIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// subscribers returns the chats subscribed to the device.
+func (s *subscriptions) subscribers(id string) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var chatIDs []int64
+	for chatID, ids := range s.chats {
+		if slices.Contains(ids, id) {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs
+}
+
+// advance records the publish time of the newest report of the device and returns the previous one,
+// or the baseline the device was subscribed at. It reports false if the device had neither, which only
+// happens for subscriptions saved without a baseline, so their reports published before the first poll are not sent.
+// The publish times are saved with the subscriptions, so reports published while the bot was stopped are sent.
+func (s *subscriptions) advance(id string, published time.Time) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.published[id]
+	if !published.After(previous) {
+		return previous, ok, nil
+	}
+	s.published[id] = published
+	return previous, ok, s.save()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubscribeBaseline(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "subscriptions.json")
+	s, err := loadSubscriptions(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.add(1, baseline, "bag"); err != nil {
+		t.Fatal(err)
+	}
+	// the first poll sends the reports published after subscribing
+	previous, ok, err := s.advance("bag", baseline.Add(time.Hour))
+	if err != nil || !ok || !previous.Equal(baseline) {
+		t.Fatalf("first poll got %s, %t, %v, want the baseline %s", previous, ok, err, baseline)
+	}
+
+	// another chat subscribing does not move the baseline of a polled device
+	if err := s.add(2, baseline.Add(2*time.Hour), "bag"); err != nil {
+		t.Fatal(err)
+	}
+	if previous, _, _ := s.advance("bag", baseline.Add(3*time.Hour)); !previous.Equal(baseline.Add(time.Hour)) {
+		t.Errorf("got %s after second subscription, want the last poll %s", previous, baseline.Add(time.Hour))
+	}
+
+	// resubscribing after all chats unsubscribed starts over, instead of sending the reports in between
+	if err := s.remove(1, "bag"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.remove(2, "bag"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.add(1, baseline.Add(24*time.Hour), "bag"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the baseline is saved with the subscriptions
+	s, err = loadSubscriptions(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, ok, _ = s.advance("bag", baseline.Add(25*time.Hour))
+	if !ok || !previous.Equal(baseline.Add(24*time.Hour)) {
+		t.Errorf("got %s, %t after reloading, want %s", previous, ok, baseline.Add(24*time.Hour))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// BatteryThresholds are the comma separated battery voltages in millivolts below which the battery
+// is reported as medium, low and critical, for example "3700,3500,3300".
+// Uses findmy.DefaultBatteryThresholds when empty.
+var BatteryThresholds string
+
+// batteryInterval is how often the battery voltage is sampled.
+const batteryInterval = 10 * time.Minute
+
+// parseThresholds parses the BatteryThresholds setting.
+func parseThresholds(s string) (findmy.BatteryThresholds, error) {
+	if s == "" {
+		return findmy.DefaultBatteryThresholds, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return findmy.BatteryThresholds{}, errors.New("battery thresholds must be 3 comma separated values")
+	}
+	var mv [3]uint16
+	for i, part := range parts {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 16)
+		if err != nil {
+			return findmy.BatteryThresholds{}, errors.New("invalid battery threshold: " + part)
+		}
+		mv[i] = uint16(v)
+	}
+	if mv[0] < mv[1] || mv[1] < mv[2] {
+		return findmy.BatteryThresholds{}, errors.New("battery thresholds must be in descending order")
+	}
+
+	return findmy.BatteryThresholds{Medium: mv[0], Low: mv[1], Critical: mv[2]}, nil
+}
+
+// batteryStatus samples the battery voltage and returns the FindMy status.
+// Boards without battery sensing always report a full battery.
+func batteryStatus(thresholds findmy.BatteryThresholds) byte {
+	mv, ok := readBattery()
+	if !ok {
+		return findmy.StatusBatteryFull
+	}
+	println("battery voltage", mv, "mV")
+	return thresholds.Status(mv)
+}
@@ -0,0 +1,23 @@
+//go:build badger2040_w
+
+package main
+
+import "machine"
+
+// The Badger 2040 W measures VSYS through a 1:3 voltage divider on GPIO29 (ADC3).
+var batteryADC = machine.ADC{Pin: machine.ADC3}
+
+const (
+	batteryReference = 3300
+	batteryDivider   = 3
+)
+
+func initBattery() {
+	machine.InitADC()
+	batteryADC.Configure(machine.ADCConfig{Reference: batteryReference})
+}
+
+// readBattery returns the battery voltage in millivolts.
+func readBattery() (uint16, bool) {
+	return uint16(uint32(batteryADC.Get()) * batteryReference * batteryDivider / 0xffff), true
+}
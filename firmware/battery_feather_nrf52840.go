@@ -0,0 +1,23 @@
+//go:build feather_nrf52840
+
+package main
+
+import "machine"
+
+// The Feather nRF52840 measures VBAT through a 1:2 voltage divider on P0.29 (A6).
+var batteryADC = machine.ADC{Pin: machine.A6}
+
+const (
+	batteryReference = 3600
+	batteryDivider   = 2
+)
+
+func initBattery() {
+	machine.InitADC()
+	batteryADC.Configure(machine.ADCConfig{Reference: batteryReference})
+}
+
+// readBattery returns the battery voltage in millivolts.
+func readBattery() (uint16, bool) {
+	return uint16(uint32(batteryADC.Get()) * batteryReference * batteryDivider / 0xffff), true
+}
@@ -0,0 +1,10 @@
+//go:build !badger2040_w && !feather_nrf52840
+
+package main
+
+func initBattery() {}
+
+// readBattery reports that the board can not measure its battery voltage.
+func readBattery() (uint16, bool) {
+	return 0, false
+}
@@ -4,6 +4,12 @@
 // To build:
 // tinygo flash -target nano-rp2040 -ldflags="-X main.AdvertisingKey='SGVsbG8sIFdvcmxkIQ=='" .
 //
+// Several comma separated keys can be given, the device rotates through them every RotationInterval:
+// -ldflags="-X main.AdvertisingKey='KEY1,KEY2,KEY3' -X main.RotationInterval=15m"
+//
+// Battery thresholds in millivolts for medium, low and critical can be set with:
+// -ldflags="-X main.AdvertisingKey='SGVsbG8sIFdvcmxkIQ==' -X main.BatteryThresholds=3700,3500,3300"
+//
 // For Linux:
 // go run . SGVsbG8sIFdvcmxkIQ==
 package main
@@ -11,60 +17,105 @@ package main
 import (
 	"encoding/base64"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
 	"tinygo.org/x/bluetooth"
 )
 
+// RotationInterval is the time each key is advertised for, when more than one key is given.
+var RotationInterval = "15m"
+
 var adapter = bluetooth.DefaultAdapter
 
 func main() {
 	// wait for USB serial to be available
 	time.Sleep(2 * time.Second)
 
-	key, err := getKeyData()
+	keys, err := getKeys()
 	if err != nil {
 		fail("failed to get key data: " + err.Error())
 	}
-	println("key is", AdvertisingKey, "(", len(key), "bytes)")
+	println("using", len(keys), "keys")
 
-	opts := bluetooth.AdvertisementOptions{
-		AdvertisementType: bluetooth.AdvertisingTypeNonConnInd,
-		Interval:          bluetooth.NewDuration(1285000 * time.Microsecond), // 1285ms
-		ManufacturerData:  []bluetooth.ManufacturerDataElement{findmy.NewData(key)},
+	rotation, err := time.ParseDuration(RotationInterval)
+	if err != nil || rotation <= 0 {
+		fail("invalid rotation interval: " + RotationInterval)
 	}
 
-	must("enable BLE stack", adapter.Enable())
+	thresholds, err := parseThresholds(BatteryThresholds)
+	if err != nil {
+		fail("failed to parse battery thresholds: " + err.Error())
+	}
+	initBattery()
+	status := batteryStatus(thresholds)
 
-	// Set the address to the first 6 bytes of the public key.
-	adapter.SetRandomAddress(bluetooth.MAC{key[5], key[4], key[3], key[2], key[1], key[0] | 0xC0})
+	must("enable BLE stack", adapter.Enable())
 
-	println("configure advertising...")
+	current := 0
 	adv := adapter.DefaultAdvertisement()
-	must("config adv", adv.Configure(opts))
+	configure(adv, keys[current], status)
 
 	println("start advertising...")
 	must("start adv", adv.Start())
 
-	address, _ := adapter.Address()
+	lastSample, lastRotation := time.Now(), time.Now()
 	for {
-		println("FindMy device using", address.MAC.String())
+		address, _ := adapter.Address()
+		println("FindMy device using", address.MAC.String(), "battery", findmy.BatteryStatus(status))
 		time.Sleep(time.Second)
+
+		reconfigure := false
+		if len(keys) > 1 && time.Since(lastRotation) >= rotation {
+			lastRotation = time.Now()
+			current = (current + 1) % len(keys)
+			println("rotate to key", current)
+			reconfigure = true
+		}
+		if time.Since(lastSample) >= batteryInterval {
+			lastSample = time.Now()
+			if newStatus := batteryStatus(thresholds); newStatus != status {
+				status = newStatus
+				reconfigure = true
+			}
+		}
+		if reconfigure {
+			must("stop adv", adv.Stop())
+			configure(adv, keys[current], status)
+			must("start adv", adv.Start())
+		}
 	}
 }
 
-// getKeyData returns the public key data from the base64 encoded string.
-func getKeyData() ([]byte, error) {
-	val, err := base64.StdEncoding.DecodeString(AdvertisingKey)
-	if err != nil {
-		return nil, err
-	}
-	if len(val) != 28 {
-		return nil, errors.New("public key must be 28 bytes long")
+// configure sets the address and the advertisement data for the key.
+func configure(adv *bluetooth.Advertisement, key []byte, status byte) {
+	// Set the address to the first 6 bytes of the public key.
+	adapter.SetRandomAddress(bluetooth.MAC{key[5], key[4], key[3], key[2], key[1], key[0] | 0xC0})
+
+	println("configure advertising...")
+	must("config adv", adv.Configure(bluetooth.AdvertisementOptions{
+		AdvertisementType: bluetooth.AdvertisingTypeNonConnInd,
+		Interval:          bluetooth.NewDuration(1285000 * time.Microsecond), // 1285ms
+		ManufacturerData:  []bluetooth.ManufacturerDataElement{findmy.NewData(key, status)},
+	}))
+}
+
+// getKeys returns the public keys from the comma separated base64 encoded strings.
+func getKeys() ([][]byte, error) {
+	var keys [][]byte
+	for _, s := range strings.Split(AdvertisingKey, ",") {
+		val, err := base64.StdEncoding.DecodeString(strings.Trim(s, "' "))
+		if err != nil {
+			return nil, err
+		}
+		if len(val) != 28 {
+			return nil, errors.New("public key must be 28 bytes long")
+		}
+		keys = append(keys, val)
 	}
 
-	return val, nil
+	return keys, nil
 }
 
 // must calls a function and fails if an error occurs.
@@ -0,0 +1,154 @@
+// Package beacon advertises the keys of FindMy devices from a computer, rotating through the keys
+// of the devices on a schedule.
+//
+// The Advertiser interface decouples the schedule from the Bluetooth stack. HCI advertises through a raw
+// HCI socket on Linux, which unlike BlueZ allows setting the address and interval of the advertisement.
+// BlueZ advertisements cannot be used, as the address carries the first bytes of the advertisement key
+// and the kernel sends non-connectable BlueZ advertisements from a non-resolvable private address.
+package beacon
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// DefaultRotation is the time each static key is advertised for, when more than one is available.
+const DefaultRotation = 15 * time.Minute
+
+// Advertiser advertises FindMy data.
+type Advertiser interface {
+	// Advertise starts advertising the 28 byte advertisement key, replacing any previous advertisement.
+	Advertise(key []byte, status byte) error
+	// Stop stops advertising.
+	Stop() error
+}
+
+// Config configures a beacon.
+type Config struct {
+	// Rotation is the time each static key is advertised for. Devices using key derivation follow their own schedule.
+	Rotation time.Duration
+	// Status is the advertised status byte, see findmy.StatusBatteryFull.
+	Status byte
+	// Logger receives the status of the beacon. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// slot is a device key advertised during one rotation.
+type slot struct {
+	device *device.Device
+	// key is the index of the static key, unused for devices using key derivation
+	key int
+}
+
+// Beacon advertises the keys of one or more devices, one at a time.
+type Beacon struct {
+	adv    Advertiser
+	config Config
+	slots  []slot
+}
+
+// New creates a beacon advertising the devices through adv.
+func New(adv Advertiser, devices []device.Device, config Config) (*Beacon, error) {
+	if len(devices) == 0 {
+		return nil, errors.New("no devices to advertise")
+	}
+	if config.Rotation <= 0 {
+		config.Rotation = DefaultRotation
+	}
+	if config.Status == 0 {
+		config.Status = findmy.StatusBatteryFull
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	b := &Beacon{adv: adv, config: config}
+	for i := range devices {
+		d := &devices[i]
+		if d.UsesDerivation() {
+			b.slots = append(b.slots, slot{device: d})
+			continue
+		}
+		for k := range d.StaticKeys() {
+			b.slots = append(b.slots, slot{device: d, key: k})
+		}
+	}
+	return b, nil
+}
+
+// KeyAt returns the device and the key advertised at time t.
+// The schedule only depends on the time, so a restarted beacon continues with the same key.
+func (b *Beacon) KeyAt(t time.Time) (*device.Device, *device.Key, error) {
+	s := b.slots[int(t.UnixNano()/int64(b.config.Rotation))%len(b.slots)]
+	if s.device.UsesDerivation() {
+		key, err := s.device.KeyAt(s.device.Period(t))
+		return s.device, key, err
+	}
+	return s.device, &s.device.StaticKeys()[s.key], nil
+}
+
+// Run advertises until the context is done, then stops the advertisement.
+func (b *Beacon) Run(ctx context.Context) error {
+	log := b.config.Logger
+	ticker := time.NewTicker(min(time.Second, b.config.Rotation/4))
+	defer ticker.Stop()
+
+	var current string
+	for {
+		d, key, err := b.KeyAt(time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to get key of device %s: %w", d.Name, err)
+		}
+		if key.AdvertisementKey != current {
+			if err := b.advertise(d, key); err != nil {
+				b.adv.Stop()
+				return err
+			}
+			current = key.AdvertisementKey
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("stopping advertisement")
+			if err := b.adv.Stop(); err != nil {
+				return fmt.Errorf("failed to stop advertisement: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Beacon) advertise(d *device.Device, key *device.Key) error {
+	advKey, err := base64.StdEncoding.DecodeString(key.AdvertisementKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode advertisement key of device %s: %w", d.Name, err)
+	}
+	if len(advKey) != 28 {
+		return fmt.Errorf("invalid advertisement key length %d for device %s", len(advKey), d.Name)
+	}
+
+	if err := b.adv.Advertise(advKey, b.config.Status); err != nil {
+		b.config.Logger.Error("failed to advertise", "device", d.Name, "error", err)
+		return fmt.Errorf("failed to advertise device %s: %w", d.Name, err)
+	}
+	b.config.Logger.Info("advertising",
+		"device", d.Name,
+		"address", Address(advKey),
+		"key", key.AdvertisementKey,
+		"period", key.Period,
+		"battery", findmy.BatteryStatus(b.config.Status))
+	return nil
+}
+
+// Address returns the printable random static address a device with the advertisement key uses.
+func Address(key []byte) string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", key[0]|0xc0, key[1], key[2], key[3], key[4], key[5])
+}
@@ -0,0 +1,236 @@
+package beacon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/scanner"
+	"tinygo.org/x/bluetooth"
+)
+
+var testKey = []byte{0xce, 0x8b, 0xad, 0x5f, 0x8a, 0x02, 0x71, 0x53, 0x8f, 0xf5, 0xaf, 0xda, 0x87, 0x49, 0x8c, 0xb0, 0x67, 0xe9, 0xa0, 0x20, 0xd6, 0xe4, 0x16, 0x78, 0x01, 0xd5, 0x5d, 0x83}
+
+type fakeAdvertiser struct {
+	mu      sync.Mutex
+	keys    [][]byte
+	stopped bool
+}
+
+func (a *fakeAdvertiser) Advertise(key []byte, status byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = append(a.keys, key)
+	a.stopped = false
+	return nil
+}
+
+func (a *fakeAdvertiser) Stop() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopped = true
+	return nil
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestKeyAt(t *testing.T) {
+	static, err := device.Generate("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := static.AddKeys(1); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	derived, err := device.GenerateDerived("derived", start, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(&fakeAdvertiser{}, []device.Device{*static, *derived}, Config{Rotation: 15 * time.Minute, Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := static.StaticKeys()
+	tests := []struct {
+		t      time.Time
+		device string
+		key    string
+	}{
+		{start, "static", keys[0].ID},
+		{start.Add(15 * time.Minute), "static", keys[1].ID},
+		{start.Add(30 * time.Minute), "derived", ""},
+		{start.Add(45 * time.Minute), "static", keys[0].ID},
+	}
+	for _, test := range tests {
+		d, key, err := b.KeyAt(test.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name != test.device {
+			t.Errorf("expected device %s at %v, got %s", test.device, test.t, d.Name)
+		}
+		if test.key != "" && key.ID != test.key {
+			t.Errorf("unexpected key at %v", test.t)
+		}
+	}
+
+	// derived devices advertise the key of the current period
+	_, key, err := b.KeyAt(start.Add(30 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Period != 31 {
+		t.Errorf("expected period 31, got %d", key.Period)
+	}
+}
+
+func TestRun(t *testing.T) {
+	d, err := device.Generate("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddKeys(1); err != nil {
+		t.Fatal(err)
+	}
+
+	adv := &fakeAdvertiser{}
+	var log bytes.Buffer
+	b, err := New(adv, []device.Device{*d}, Config{Rotation: 20 * time.Millisecond, Logger: slog.New(slog.NewJSONHandler(&log, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	adv.mu.Lock()
+	defer adv.mu.Unlock()
+	if !adv.stopped {
+		t.Errorf("expected advertisement to be stopped")
+	}
+	if len(adv.keys) < 3 {
+		t.Fatalf("expected keys to rotate, got %d advertisements", len(adv.keys))
+	}
+	for i := 1; i < len(adv.keys); i++ {
+		if bytes.Equal(adv.keys[i], adv.keys[i-1]) {
+			t.Errorf("expected a different key after rotation")
+		}
+	}
+	if !bytes.Contains(log.Bytes(), []byte(`"msg":"advertising","device":"static"`)) {
+		t.Errorf("expected structured log of the advertised device, got %s", log.String())
+	}
+}
+
+type fakeTransport struct {
+	commands []command
+}
+
+func (t *fakeTransport) send(c command) error {
+	t.commands = append(t.commands, c)
+	return nil
+}
+
+func (t *fakeTransport) close() error {
+	return nil
+}
+
+func TestHCI(t *testing.T) {
+	transport := &fakeTransport{}
+	h, err := newHCI(transport, HCIOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Advertise(testKey, findmy.StatusBatteryLow); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transport.commands) != 4 {
+		t.Fatalf("expected 4 commands, got %d", len(transport.commands))
+	}
+	address := transport.commands[0]
+	if address.opcode != 0x2005 || !bytes.Equal(address.params, []byte{0x02, 0x8a, 0x5f, 0xad, 0x8b, 0xce}) {
+		t.Errorf("unexpected set random address command %04x % x", address.opcode, address.params)
+	}
+	params := transport.commands[1]
+	if params.opcode != 0x2006 || len(params.params) != 15 || params.params[0] != 0x08 || params.params[1] != 0x08 {
+		t.Errorf("unexpected advertising parameters % x", params.params)
+	}
+
+	// the advertising data must decode as the advertisement of the key
+	data := transport.commands[2]
+	if data.opcode != 0x2008 || len(data.params) != 32 || data.params[0] != 31 {
+		t.Fatalf("unexpected advertising data % x", data.params)
+	}
+	if !bytes.Equal(data.params[1:5], []byte{0x1e, 0xff, 0x4c, 0x00}) {
+		t.Errorf("expected Apple manufacturer data, got % x", data.params[1:5])
+	}
+	mac := bluetooth.MAC{address.params[0], address.params[1], address.params[2], address.params[3], address.params[4], address.params[5]}
+	event, ok := scanner.Decode(scanner.Advertisement{
+		MAC:              mac,
+		ManufacturerData: []bluetooth.ManufacturerDataElement{{CompanyID: findmy.AppleCompanyID, Data: data.params[5:]}},
+	})
+	if !ok || !bytes.Equal(event.Key, testKey) || event.Status != findmy.StatusBatteryLow {
+		t.Errorf("advertising data does not decode to the key: %+v", event)
+	}
+	if enable := transport.commands[3]; enable.opcode != 0x200a || !bytes.Equal(enable.params, []byte{0x01}) {
+		t.Errorf("unexpected enable command % x", enable.params)
+	}
+
+	// advertising is disabled before switching keys and when stopping
+	transport.commands = nil
+	if err := h.Advertise(testKey, findmy.StatusBatteryFull); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.commands) != 6 || !bytes.Equal(transport.commands[0].params, []byte{0x00}) || !bytes.Equal(transport.commands[5].params, []byte{0x00}) {
+		t.Errorf("expected advertising to be disabled before reconfiguring and on close")
+	}
+}
+
+func TestHCIExtended(t *testing.T) {
+	transport := &fakeTransport{}
+	power := int8(-4)
+	h, err := newHCI(transport, HCIOptions{Interval: 100 * time.Millisecond, TxPower: &power})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Advertise(testKey, findmy.StatusBatteryFull); err != nil {
+		t.Fatal(err)
+	}
+
+	var opcodes []uint16
+	for _, c := range transport.commands {
+		opcodes = append(opcodes, c.opcode)
+	}
+	if len(opcodes) != 4 || opcodes[0] != 0x2036 || opcodes[1] != 0x2035 || opcodes[2] != 0x2037 || opcodes[3] != 0x2039 {
+		t.Fatalf("unexpected extended advertising commands %04x", opcodes)
+	}
+	params := transport.commands[0].params
+	if len(params) != 25 || params[3] != 160 || params[19] != 0xfc {
+		t.Errorf("unexpected extended advertising parameters % x", params)
+	}
+
+	if _, err := newHCI(transport, HCIOptions{Interval: 10 * time.Millisecond}); err != ErrInvalidInterval {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	if got := Address(testKey); got != "CE:8B:AD:5F:8A:02" {
+		t.Errorf("expected address CE:8B:AD:5F:8A:02, got %s", got)
+	}
+}
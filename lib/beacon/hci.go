@@ -0,0 +1,184 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// DefaultInterval is the advertising interval used by the firmware.
+const DefaultInterval = 1285 * time.Millisecond
+
+// HCIOptions configures the advertisement of an HCI advertiser.
+type HCIOptions struct {
+	// Interval is the advertising interval, between 20ms and 10.24s. Defaults to DefaultInterval.
+	Interval time.Duration
+	// TxPower is the requested transmit power in dBm, nil leaves it to the controller.
+	// Setting it requires a Bluetooth 5 controller supporting extended advertising.
+	TxPower *int8
+}
+
+var ErrInvalidInterval = errors.New("beacon: advertising interval must be between 20ms and 10.24s")
+
+// LE controller commands, see Bluetooth Core Specification Vol 4, Part E, 7.8.
+const (
+	ogfLE = 0x08
+
+	ocfSetRandomAddress                = 0x0005
+	ocfSetAdvertisingParameters        = 0x0006
+	ocfSetAdvertisingData              = 0x0008
+	ocfSetAdvertisingEnable            = 0x000a
+	ocfSetAdvertisingSetRandomAddress  = 0x0035
+	ocfSetExtendedAdvertisingParams    = 0x0036
+	ocfSetExtendedAdvertisingData      = 0x0037
+	ocfSetExtendedAdvertisingEnable    = 0x0039
+	advertisingTypeNonConnectable      = 0x03
+	advertisingPropertiesLegacyNonConn = 0x0010
+	ownAddressRandom                   = 0x01
+	allChannels                        = 0x07
+	phyLE1M                            = 0x01
+)
+
+// command is an HCI command.
+type command struct {
+	opcode uint16
+	params []byte
+}
+
+func newCommand(ocf uint16, params ...byte) command {
+	return command{opcode: ogfLE<<10 | ocf, params: params}
+}
+
+// packet returns the command as an HCI command packet.
+func (c command) packet() []byte {
+	p := []byte{0x01, byte(c.opcode), byte(c.opcode >> 8), byte(len(c.params))}
+	return append(p, c.params...)
+}
+
+// transport sends HCI commands to a controller and waits for their completion.
+type transport interface {
+	send(c command) error
+	close() error
+}
+
+// HCI advertises through the HCI commands of a Bluetooth controller, bypassing the Bluetooth stack of the OS.
+type HCI struct {
+	transport   transport
+	options     HCIOptions
+	interval    uint16
+	advertising bool
+}
+
+func newHCI(t transport, options HCIOptions) (*HCI, error) {
+	if options.Interval == 0 {
+		options.Interval = DefaultInterval
+	}
+	// the interval is set in units of 0.625ms
+	interval := options.Interval / 625 / time.Microsecond
+	if interval < 0x0020 || interval > 0x4000 {
+		return nil, ErrInvalidInterval
+	}
+	return &HCI{transport: t, options: options, interval: uint16(interval)}, nil
+}
+
+// Advertise advertises the key from the random static address derived from it.
+func (h *HCI) Advertise(key []byte, status byte) error {
+	if len(key) != 28 {
+		return fmt.Errorf("beacon: invalid advertisement key length %d", len(key))
+	}
+	for _, c := range h.commands(key, status) {
+		if err := h.transport.send(c); err != nil {
+			return err
+		}
+	}
+	h.advertising = true
+	return nil
+}
+
+// Stop stops advertising.
+func (h *HCI) Stop() error {
+	if !h.advertising {
+		return nil
+	}
+	if err := h.transport.send(h.enable(false)); err != nil {
+		return err
+	}
+	h.advertising = false
+	return nil
+}
+
+// Close stops advertising and closes the connection to the controller.
+func (h *HCI) Close() error {
+	stopErr := h.Stop()
+	return errors.Join(stopErr, h.transport.close())
+}
+
+// commands returns the commands to (re)start advertising the key.
+// The address and parameters can only be changed while advertising is disabled.
+func (h *HCI) commands(key []byte, status byte) []command {
+	// the address is sent little endian, with the two most significant bits set for a random static address
+	address := []byte{key[5], key[4], key[3], key[2], key[1], key[0] | 0xc0}
+	md := findmy.NewData(key, status)
+	data := append([]byte{byte(len(md.Data) + 3), 0xff, byte(findmy.AppleCompanyID), byte(findmy.AppleCompanyID >> 8)}, md.Data...)
+
+	var commands []command
+	if h.advertising {
+		commands = append(commands, h.enable(false))
+	}
+
+	if h.options.TxPower == nil {
+		params := make([]byte, 15)
+		binary.LittleEndian.PutUint16(params[0:], h.interval)
+		binary.LittleEndian.PutUint16(params[2:], h.interval)
+		params[4] = advertisingTypeNonConnectable
+		params[5] = ownAddressRandom
+		params[13] = allChannels
+
+		advData := make([]byte, 32)
+		advData[0] = byte(len(data))
+		copy(advData[1:], data)
+
+		return append(commands,
+			newCommand(ocfSetRandomAddress, address...),
+			newCommand(ocfSetAdvertisingParameters, params...),
+			newCommand(ocfSetAdvertisingData, advData...),
+			h.enable(true))
+	}
+
+	// extended advertising with a single legacy advertising set with handle 0
+	params := make([]byte, 25)
+	binary.LittleEndian.PutUint16(params[1:], advertisingPropertiesLegacyNonConn)
+	params[3], params[4] = byte(h.interval), byte(h.interval>>8)
+	params[6], params[7] = byte(h.interval), byte(h.interval>>8)
+	params[9] = allChannels
+	params[10] = ownAddressRandom
+	params[19] = byte(*h.options.TxPower)
+	params[20] = phyLE1M
+	params[22] = phyLE1M
+
+	return append(commands,
+		newCommand(ocfSetExtendedAdvertisingParams, params...),
+		newCommand(ocfSetAdvertisingSetRandomAddress, append([]byte{0}, address...)...),
+		// complete data, controller may not fragment
+		newCommand(ocfSetExtendedAdvertisingData, append([]byte{0, 0x03, 0x01, byte(len(data))}, data...)...),
+		h.enable(true))
+}
+
+// enable returns the command to enable or disable advertising.
+func (h *HCI) enable(enable bool) command {
+	if h.options.TxPower == nil {
+		if enable {
+			return newCommand(ocfSetAdvertisingEnable, 0x01)
+		}
+		return newCommand(ocfSetAdvertisingEnable, 0x00)
+	}
+	if enable {
+		// one set with handle 0, no duration and event limit
+		return newCommand(ocfSetExtendedAdvertisingEnable, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00)
+	}
+	// disable all sets
+	return newCommand(ocfSetExtendedAdvertisingEnable, 0x00, 0x00)
+}
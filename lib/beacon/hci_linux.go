@@ -0,0 +1,119 @@
+//go:build linux
+
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// hciFilter is the socket option setting the packets received on a raw HCI socket.
+	hciFilter = 2
+
+	hciCommandPacket = 0x01
+	hciEventPacket   = 0x04
+
+	eventCommandComplete = 0x0e
+	eventCommandStatus   = 0x0f
+
+	// commandTimeout is how long to wait for the controller to complete a command.
+	commandTimeout = 2 * time.Second
+)
+
+// socket is a raw HCI socket bound to a controller.
+type socket struct {
+	fd int
+}
+
+// OpenHCI opens the Bluetooth controller hciN for advertising. It requires the CAP_NET_RAW and CAP_NET_ADMIN
+// capabilities, and BlueZ must not advertise on the same controller.
+func OpenHCI(dev int, options HCIOptions) (*HCI, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HCI socket: %w", err)
+	}
+	s := &socket{fd: fd}
+
+	if err := unix.Bind(fd, &unix.SockaddrHCI{Dev: uint16(dev), Channel: unix.HCI_CHANNEL_RAW}); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to bind to hci%d: %w", dev, err)
+	}
+
+	// struct hci_filter: type mask, event mask and opcode
+	filter := make([]byte, 14)
+	filter[0] = 1 << hciEventPacket
+	filter[4+eventCommandComplete/8] |= 1 << (eventCommandComplete % 8)
+	filter[4+eventCommandStatus/8] |= 1 << (eventCommandStatus % 8)
+	if err := unix.SetsockoptString(fd, unix.SOL_HCI, hciFilter, string(filter)); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to set HCI filter: %w", err)
+	}
+
+	timeout := unix.NsecToTimeval(commandTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to set HCI timeout: %w", err)
+	}
+
+	h, err := newHCI(s, options)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (s *socket) send(c command) error {
+	if _, err := unix.Write(s.fd, c.packet()); err != nil {
+		return fmt.Errorf("failed to send HCI command 0x%04x: %w", c.opcode, err)
+	}
+
+	buf := make([]byte, 260)
+	deadline := time.Now().Add(commandTimeout)
+	for time.Now().Before(deadline) {
+		n, err := unix.Read(s.fd, buf)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read HCI event for command 0x%04x: %w", c.opcode, err)
+		}
+
+		// event packet: packet type, event code, parameter length, parameters
+		if n < 3 || buf[0] != hciEventPacket {
+			continue
+		}
+		params := buf[3:n]
+		var status byte
+		switch {
+		case buf[1] == eventCommandComplete && len(params) >= 4:
+			// number of packets, opcode, return parameters starting with the status
+			if uint16(params[1])|uint16(params[2])<<8 != c.opcode {
+				continue
+			}
+			status = params[3]
+		case buf[1] == eventCommandStatus && len(params) >= 4:
+			// status, number of packets, opcode
+			if uint16(params[2])|uint16(params[3])<<8 != c.opcode {
+				continue
+			}
+			status = params[0]
+		default:
+			continue
+		}
+
+		if status != 0 {
+			return fmt.Errorf("HCI command 0x%04x failed with status 0x%02x", c.opcode, status)
+		}
+		return nil
+	}
+	return fmt.Errorf("timeout waiting for HCI command 0x%04x", c.opcode)
+}
+
+func (s *socket) close() error {
+	return unix.Close(s.fd)
+}
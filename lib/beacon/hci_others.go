@@ -0,0 +1,10 @@
+//go:build !linux
+
+package beacon
+
+import "errors"
+
+// OpenHCI opens the Bluetooth controller hciN for advertising. Raw HCI sockets are only available on Linux.
+func OpenHCI(dev int, options HCIOptions) (*HCI, error) {
+	return nil, errors.New("beacon: HCI advertising is only supported on Linux")
+}
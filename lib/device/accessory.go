@@ -0,0 +1,191 @@
+package device
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appleReferenceDate is the epoch of dates encoded by OpenHaystack.
+var appleReferenceDate = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// defaultColorComponents is the color of accessories without a color, green.
+var defaultColorComponents = []float64{0, 1, 0, 1}
+
+// Accessory is an accessory in the accessories file of macless-haystack and OpenHaystack.
+type Accessory struct {
+	ID              int64     `json:"id"`
+	ColorComponents []float64 `json:"colorComponents"`
+	Name            string    `json:"name"`
+	// PrivateKey is the base64 encoded master private key.
+	PrivateKey     string `json:"privateKey"`
+	Icon           string `json:"icon"`
+	IsDeployed     bool   `json:"isDeployed"`
+	ColorSpaceName string `json:"colorSpaceName"`
+	UsesDerivation bool   `json:"usesDerivation"`
+	// SymmetricKey is the base64 encoded symmetric key at LastDerivationTimestamp.
+	SymmetricKey               string `json:"symmetricKey,omitempty"`
+	OldestRelevantSymmetricKey string `json:"oldestRelevantSymmetricKey,omitempty"`
+	// LastDerivationTimestamp is in seconds since the Apple reference date, 2001-01-01 UTC.
+	LastDerivationTimestamp float64 `json:"lastDerivationTimestamp,omitempty"`
+	// UpdateInterval is the duration of a key period in seconds.
+	UpdateInterval float64  `json:"updateInterval,omitempty"`
+	IsActive       bool     `json:"isActive"`
+	AdditionalKeys []string `json:"additionalKeys"`
+}
+
+// NewAccessory returns the accessory of the device.
+func NewAccessory(d *Device) *Accessory {
+	a := &Accessory{
+		ID:              accessoryID(d.ID),
+		ColorComponents: colorComponents(d.Color),
+		Name:            d.Name,
+		PrivateKey:      base64.StdEncoding.EncodeToString(d.PrivateKey),
+		Icon:            d.Icon,
+		IsDeployed:      true,
+		ColorSpaceName:  "kCGColorSpaceExtendedSRGB",
+		AdditionalKeys:  []string{},
+	}
+	for _, k := range d.AdditionalKeys {
+		a.AdditionalKeys = append(a.AdditionalKeys, base64.StdEncoding.EncodeToString(k.PrivateKey))
+	}
+	if d.UsesDerivation() {
+		sk := base64.StdEncoding.EncodeToString(d.SymmetricKey)
+		a.UsesDerivation = true
+		a.SymmetricKey = sk
+		a.OldestRelevantSymmetricKey = sk
+		a.LastDerivationTimestamp = d.DerivationStart.Sub(appleReferenceDate).Seconds()
+		a.UpdateInterval = d.UpdateInterval.Seconds()
+	}
+	return a
+}
+
+// Device returns the device of the accessory. Accessories without a name are named by their ID.
+func (a *Accessory) Device() (*Device, error) {
+	name := strings.TrimSpace(a.Name)
+	if name == "" {
+		name = strconv.FormatInt(a.ID, 10)
+	}
+
+	master, err := decodeAccessoryKey(a.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{
+		Name:             name,
+		ID:               master.ID,
+		AdvertisementKey: master.AdvertisementKey,
+		PrivateKey:       master.PrivateKey,
+		Icon:             a.Icon,
+		Color:            colorFromComponents(a.ColorComponents),
+	}
+	for _, k := range a.AdditionalKeys {
+		key, err := decodeAccessoryKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("additional key: %w", err)
+		}
+		d.AdditionalKeys = append(d.AdditionalKeys, *key)
+	}
+
+	if a.UsesDerivation {
+		sk, err := base64.StdEncoding.DecodeString(a.SymmetricKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode symmetric key: %w", err)
+		}
+		if len(sk) == 0 || a.UpdateInterval <= 0 {
+			return nil, fmt.Errorf("accessory using key derivation without symmetric key or update interval")
+		}
+		d.SymmetricKey = sk
+		d.DerivationStart = appleReferenceDate.Add(time.Duration(a.LastDerivationTimestamp * float64(time.Second))).Truncate(time.Second)
+		d.UpdateInterval = time.Duration(a.UpdateInterval * float64(time.Second))
+	}
+	return d, nil
+}
+
+// MarshalAccessories returns the accessories file of the devices, which the macless-haystack web UI imports at once.
+func MarshalAccessories(devices ...*Device) ([]byte, error) {
+	accessories := make([]*Accessory, 0, len(devices))
+	for _, d := range devices {
+		accessories = append(accessories, NewAccessory(d))
+	}
+	return json.MarshalIndent(accessories, "", "    ")
+}
+
+// UnmarshalAccessories returns the devices of an accessories file, which is either a list of accessories
+// or a single accessory.
+func UnmarshalAccessories(data []byte) ([]Device, error) {
+	var accessories []Accessory
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		accessories = make([]Accessory, 1)
+		err = json.Unmarshal(data, &accessories[0])
+	} else {
+		err = json.Unmarshal(data, &accessories)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode accessories: %w", err)
+	}
+
+	devices := make([]Device, 0, len(accessories))
+	for _, a := range accessories {
+		d, err := a.Device()
+		if err != nil {
+			return nil, fmt.Errorf("failed to import accessory %q: %w", a.Name, err)
+		}
+		devices = append(devices, *d)
+	}
+	return devices, nil
+}
+
+// accessoryID returns a stable accessory ID for the hashed advertisement key, so exporting a device again
+// replaces it in the web UI instead of adding a copy.
+func accessoryID(hashedKey string) int64 {
+	hash, err := base64.StdEncoding.DecodeString(hashedKey)
+	if err != nil || len(hash) < 4 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(hash))
+}
+
+// decodeAccessoryKey decodes a base64 private key. OpenHaystack stores the key as the 85 byte uncompressed
+// representation of the key pair (0x04 || X || Y || D), of which the last 28 bytes are the private key.
+func decodeAccessoryKey(encoded string) (*Key, error) {
+	pk, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	switch len(pk) {
+	case 28:
+	case 85:
+		pk = pk[57:]
+	default:
+		return nil, fmt.Errorf("invalid private key length %d", len(pk))
+	}
+	return NewKey(pk)
+}
+
+// colorComponents returns the RGBA components of a #RRGGBB color, green if the color is not set or invalid.
+func colorComponents(color string) []float64 {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(color, "#%02x%02x%02x", &r, &g, &b); err != nil || len(color) != 7 {
+		return defaultColorComponents
+	}
+	return []float64{float64(r) / 255, float64(g) / 255, float64(b) / 255, 1}
+}
+
+// colorFromComponents returns the #RRGGBB color of the RGBA components in the range 0 to 1.
+func colorFromComponents(c []float64) string {
+	if len(c) < 3 {
+		return ""
+	}
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", channel(c[0]), channel(c[1]), channel(c[2]))
+}
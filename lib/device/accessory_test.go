@@ -0,0 +1,81 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMarshalAccessories(t *testing.T) {
+	static, err := Generate(`my "quoted" bag`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := static.AddKeys(2); err != nil {
+		t.Fatal(err)
+	}
+	static.Icon = "bag.fill"
+	static.Color = "#ff8000"
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	derived, err := GenerateDerived("keys", start, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := MarshalAccessories(static, derived)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var accessories []Accessory
+	if err := json.Unmarshal(data, &accessories); err != nil {
+		t.Fatal(err)
+	}
+	if len(accessories) != 2 {
+		t.Fatalf("expected 2 accessories, got %d", len(accessories))
+	}
+	if accessories[0].ID == 0 || accessories[0].ID != NewAccessory(static).ID {
+		t.Errorf("expected stable accessory ID, got %d", accessories[0].ID)
+	}
+	if accessories[0].UsesDerivation || !accessories[1].UsesDerivation {
+		t.Errorf("unexpected usesDerivation")
+	}
+	if accessories[1].UpdateInterval != 900 {
+		t.Errorf("expected update interval of 900 seconds, got %v", accessories[1].UpdateInterval)
+	}
+
+	devices, err := UnmarshalAccessories(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+
+	s := devices[0]
+	if s.Name != static.Name || s.Icon != static.Icon || s.Color != static.Color || s.ID != static.ID {
+		t.Errorf("unexpected static device %+v", s)
+	}
+	if len(s.AdditionalKeys) != 2 || s.AdditionalKeys[1].ID != static.AdditionalKeys[1].ID {
+		t.Errorf("expected additional keys to be exported")
+	}
+
+	d := devices[1]
+	if !d.UsesDerivation() || !d.DerivationStart.Equal(start) || d.UpdateInterval != derived.UpdateInterval ||
+		!bytes.Equal(d.SymmetricKey, derived.SymmetricKey) {
+		t.Errorf("unexpected derived device %+v", d)
+	}
+	if d.Color != "#00ff00" {
+		t.Errorf("expected default color, got %s", d.Color)
+	}
+	want, _ := derived.KeyAt(10)
+	got, err := d.KeyAt(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID {
+		t.Errorf("expected the same derived keys")
+	}
+}
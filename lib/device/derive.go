@@ -0,0 +1,142 @@
+package device
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// Key is the advertisement key pair used by a device during a single key period.
+type Key struct {
+	// Period is the index of the key period, 0 for the master key and additional keys.
+	Period           int
+	ID               string
+	AdvertisementKey string
+	PrivateKey       []byte
+}
+
+// GenerateDerived generates a new device that rotates its advertisement key every interval starting at start.
+func GenerateDerived(name string, start time.Time, interval time.Duration) (*Device, error) {
+	if interval <= 0 {
+		return nil, errors.New("update interval must be positive")
+	}
+
+	d, err := Generate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sk := make([]byte, findmy.SymmetricKeyLength)
+	if _, err := rand.Read(sk); err != nil {
+		return nil, fmt.Errorf("failed to generate symmetric key: %w", err)
+	}
+
+	d.SymmetricKey = sk
+	d.DerivationStart = start.Truncate(time.Second)
+	d.UpdateInterval = interval
+	return d, nil
+}
+
+// UsesDerivation reports whether the device advertises rolling keys derived from its master key.
+func (d *Device) UsesDerivation() bool {
+	return len(d.SymmetricKey) > 0 && d.UpdateInterval > 0
+}
+
+// Period returns the index of the key period the device is in at time t.
+// Periods are counted from 1, static devices and times before the derivation start are in period 0.
+func (d *Device) Period(t time.Time) int {
+	if !d.UsesDerivation() || t.Before(d.DerivationStart) {
+		return 0
+	}
+	return int(t.Sub(d.DerivationStart)/d.UpdateInterval) + 1
+}
+
+// PeriodStart returns the time at which the given key period begins.
+func (d *Device) PeriodStart(period int) time.Time {
+	if !d.UsesDerivation() || period <= 0 {
+		return d.DerivationStart
+	}
+	return d.DerivationStart.Add(time.Duration(period-1) * d.UpdateInterval)
+}
+
+// KeyAt returns the advertisement key used in the given key period.
+// Static devices use their master key in every period.
+func (d *Device) KeyAt(period int) (*Key, error) {
+	if !d.UsesDerivation() || period <= 0 {
+		return d.masterKey(), nil
+	}
+
+	sk := d.SymmetricKey
+	for i := 0; i < period; i++ {
+		sk = findmy.NextSymmetricKey(sk)
+	}
+	return d.derive(period, sk)
+}
+
+// KeysBetween returns the advertisement keys of all key periods overlapping the time window [from, to].
+// Static devices always return their master key and additional keys.
+func (d *Device) KeysBetween(from, to time.Time) ([]Key, error) {
+	if !d.UsesDerivation() {
+		return d.StaticKeys(), nil
+	}
+
+	first, last := max(d.Period(from), 1), d.Period(to)
+	if last < first {
+		return nil, nil
+	}
+
+	sk := d.SymmetricKey
+	for i := 0; i < first; i++ {
+		sk = findmy.NextSymmetricKey(sk)
+	}
+
+	keys := make([]Key, 0, last-first+1)
+	for period := first; period <= last; period++ {
+		key, err := d.derive(period, sk)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+		sk = findmy.NextSymmetricKey(sk)
+	}
+	return keys, nil
+}
+
+// IDs returns the hashed advertisement keys of all key periods overlapping the time window [from, to].
+func (d *Device) IDs(from, to time.Time) ([]string, error) {
+	keys, err := d.KeysBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+	}
+	return ids, nil
+}
+
+func (d *Device) masterKey() *Key {
+	return &Key{
+		ID:               d.ID,
+		AdvertisementKey: d.AdvertisementKey,
+		PrivateKey:       d.PrivateKey,
+	}
+}
+
+func (d *Device) derive(period int, symmetricKey []byte) (*Key, error) {
+	privateKey, err := findmy.DerivePrivateKey(d.PrivateKey, symmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key for period %d: %w", period, err)
+	}
+
+	key, err := NewKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key for period %d: %w", period, err)
+	}
+	key.Period = period
+	return key, nil
+}
@@ -0,0 +1,97 @@
+package device
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+func TestPeriod(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, err := GenerateDerived("test", start, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t    time.Time
+		want int
+	}{
+		{start.Add(-time.Minute), 0},
+		{start, 1},
+		{start.Add(14 * time.Minute), 1},
+		{start.Add(15 * time.Minute), 2},
+		{start.Add(24 * time.Hour), 97},
+	}
+	for _, test := range tests {
+		if got := d.Period(test.t); got != test.want {
+			t.Errorf("Period(%s) = %d, want %d", test.t, got, test.want)
+		}
+		if test.want > 0 && d.PeriodStart(test.want).After(test.t) {
+			t.Errorf("PeriodStart(%d) = %s is after %s", test.want, d.PeriodStart(test.want), test.t)
+		}
+	}
+
+	static, err := Generate("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := static.Period(start); got != 0 {
+		t.Errorf("expected period 0 for static device, got %d", got)
+	}
+}
+
+func TestKeysBetween(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, err := GenerateDerived("test", start, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := d.KeysBetween(start.Add(90*time.Minute), start.Add(5*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 {
+		t.Fatalf("expected 5 keys, got %d", len(keys))
+	}
+
+	seen := map[string]bool{d.ID: true}
+	for i, k := range keys {
+		if k.Period != i+2 {
+			t.Errorf("expected period %d, got %d", i+2, k.Period)
+		}
+		if seen[k.ID] {
+			t.Errorf("duplicate id %s for period %d", k.ID, k.Period)
+		}
+		seen[k.ID] = true
+
+		want, err := d.KeyAt(k.Period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want.ID != k.ID || !bytes.Equal(want.PrivateKey, k.PrivateKey) {
+			t.Errorf("KeyAt(%d) does not match KeysBetween", k.Period)
+		}
+
+		publicKey := findmy.PublicKey(k.PrivateKey)
+		if got := base64.StdEncoding.EncodeToString(publicKey); got != k.AdvertisementKey {
+			t.Errorf("advertisement key %s does not match private key (%s)", k.AdvertisementKey, got)
+		}
+	}
+
+	static, err := Generate("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := static.IDs(start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != static.ID {
+		t.Errorf("expected only the master id for static device, got %v", ids)
+	}
+}
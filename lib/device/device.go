@@ -1,17 +1,14 @@
 package device
 
 import (
-	"bufio"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Device struct {
@@ -19,72 +16,46 @@ type Device struct {
 	ID               string
 	AdvertisementKey string
 	PrivateKey       []byte
-}
 
-func LoadFromFile(fileName string) (*Device, error) {
-	f, err := os.Open(fileName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
-	}
-	defer f.Close()
+	// AdditionalKeys are static keys the device rotates through after the master key.
+	AdditionalKeys []Key
+
+	// SymmetricKey is the initial symmetric key (SK0) used to derive rolling keys.
+	// Devices without it advertise a single static key.
+	SymmetricKey []byte
+	// DerivationStart is the beginning of the first key period.
+	DerivationStart time.Time
+	// UpdateInterval is the duration of a single key period.
+	UpdateInterval time.Duration
+
+	// Encrypted reports whether the keys file is encrypted with the passphrase, see Passphrase.
+	Encrypted bool
+
+	// Created is the time the keys were generated.
+	Created time.Time
+	// Target is the TinyGo target the device was last flashed for.
+	Target string
+	// Notes is a single line description of the device.
+	Notes string
+	// Icon and Color are shown for the device by clients such as macless-haystack.
+	Icon  string
+	Color string
+}
 
-	baseName := filepath.Base(fileName)
-	device := Device{
-		Name: strings.TrimSuffix(baseName, ".keys"),
-	}
+// errUnsuitableKey is returned for randomly generated keys that can not be used and are generated again.
+var errUnsuitableKey = errors.New("unsuitable key")
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		key, val, found := strings.Cut(line, ": ")
-		if !found {
-			fmt.Println("invalid line:", line)
+func Generate(name string) (*Device, error) {
+	for {
+		d, err := generate(name)
+		if errors.Is(err, errUnsuitableKey) {
 			continue
 		}
-		key = strings.TrimSpace(key)
-		val = strings.TrimSpace(val)
-
-		switch key {
-		case "Private key":
-			pk, err := base64.StdEncoding.DecodeString(val)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode private key: %w", err)
-			}
-			device.PrivateKey = pk
-		case "Hashed adv key":
-			device.ID = val
-		case "Advertisement key":
-			device.AdvertisementKey = val
-		default:
-			fmt.Println("unknown key:", key, "on line:", line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read file (%s): %w", fileName, err)
+		return d, err
 	}
-	return &device, nil
 }
 
-func (d *Device) SaveToFile() error {
-	f, err := os.Create(d.Name + ".keys")
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer f.Close()
-
-	b := strings.Builder{}
-	b.WriteString(fmt.Sprintf("Private key: %s\n", d.PrivateKey))
-	b.WriteString(fmt.Sprintf("Advertisement key: %s\n", d.AdvertisementKey))
-	b.WriteString(fmt.Sprintf("Hashed adv key: %s\n", base64.StdEncoding.EncodeToString(d.PrivateKey)))
-	if _, err = f.WriteString(b.String()); err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
-	}
-
-	return nil
-}
-
-func Generate(name string) (*Device, error) {
+func generate(name string) (*Device, error) {
 	// Generate ECDSA private key using P-224 curve
 	pk, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
 	if err != nil {
@@ -96,22 +67,24 @@ func Generate(name string) (*Device, error) {
 
 	// Ensure the private key is 28 bytes long (P-224 curve)
 	if len(privateKeyBytes) != 28 {
-		return nil, errors.New("Private key is not 28 bytes long")
+		return nil, fmt.Errorf("%w: private key is not 28 bytes long", errUnsuitableKey)
 	}
 
 	// extract raw public key bytes
 	publicKeyBytes := pk.PublicKey.X.Bytes()
+	if len(publicKeyBytes) != 28 {
+		return nil, fmt.Errorf("%w: public key is not 28 bytes long", errUnsuitableKey)
+	}
 
 	// Encode the public key to Base64
 	publicKeyBase64 := base64.StdEncoding.EncodeToString(publicKeyBytes)
 
 	// Hash the public key using SHA-256
-	hash := sha256.Sum256(publicKeyBytes)
-	hashBase64 := base64.StdEncoding.EncodeToString(hash[:])
+	hashBase64 := hashKey(publicKeyBytes)
 
 	// make sure not '/' in the base64 string
 	if strings.Contains(hashBase64, "/") {
-		return nil, fmt.Errorf("hash contains '/'")
+		return nil, fmt.Errorf("%w: hash contains '/'", errUnsuitableKey)
 	}
 
 	return &Device{
@@ -0,0 +1,192 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadFromFile loads a device from a keys file. Encrypted files are decrypted with the passphrase returned by Passphrase.
+func LoadFromFile(fileName string) (*Device, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+
+	baseName := filepath.Base(fileName)
+	device := Device{
+		Name: strings.TrimSuffix(baseName, ".keys"),
+	}
+
+	if IsEncrypted(data) {
+		passphrase, err := Passphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = Decrypt(data, passphrase); err != nil {
+			return nil, fmt.Errorf("failed to decrypt file (%s): %w", fileName, err)
+		}
+		device.Encrypted = true
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, val, found := strings.Cut(line, ": ")
+		if !found {
+			fmt.Println("invalid line:", line)
+			continue
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "Private key":
+			pk, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode private key: %w", err)
+			}
+			device.PrivateKey = pk
+		case "Hashed adv key":
+			device.ID = val
+		case "Advertisement key":
+			device.AdvertisementKey = val
+		case "Additional key":
+			pk, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode additional key: %w", err)
+			}
+			k, err := NewKey(pk)
+			if err != nil {
+				return nil, fmt.Errorf("invalid additional key: %w", err)
+			}
+			device.AdditionalKeys = append(device.AdditionalKeys, *k)
+		case "Symmetric key":
+			sk, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode symmetric key: %w", err)
+			}
+			device.SymmetricKey = sk
+		case "Derivation start":
+			start, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse derivation start: %w", err)
+			}
+			device.DerivationStart = start
+		case "Update interval":
+			interval, err := time.ParseDuration(val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse update interval: %w", err)
+			}
+			device.UpdateInterval = interval
+		case "Created":
+			created, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse creation time: %w", err)
+			}
+			device.Created = created
+		case "Target":
+			device.Target = val
+		case "Notes":
+			device.Notes = val
+		case "Icon":
+			device.Icon = val
+		case "Color":
+			device.Color = val
+		default:
+			fmt.Println("unknown key:", key, "on line:", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file (%s): %w", fileName, err)
+	}
+	return &device, nil
+}
+
+// LoadFromDir loads all devices from the .keys files in the directory.
+func LoadFromDir(dir string) ([]Device, error) {
+	fileNames, err := filepath.Glob(filepath.Join(dir, "*.keys"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys files (%s): %w", dir, err)
+	}
+
+	devices := make([]Device, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		d, err := LoadFromFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *d)
+	}
+	return devices, nil
+}
+
+// SaveToFile saves the device to the keys file NAME.keys, encrypted with the passphrase returned by Passphrase
+// if the device is Encrypted.
+func (d *Device) SaveToFile() error {
+	return d.SaveAs(d.Name + ".keys")
+}
+
+// SaveAs saves the device to the keys file, see SaveToFile. An existing file is replaced only once the new one is written.
+func (d *Device) SaveAs(fileName string) error {
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("Private key: %s\n", base64.StdEncoding.EncodeToString(d.PrivateKey)))
+	b.WriteString(fmt.Sprintf("Advertisement key: %s\n", d.AdvertisementKey))
+	b.WriteString(fmt.Sprintf("Hashed adv key: %s\n", d.ID))
+	for _, k := range d.AdditionalKeys {
+		b.WriteString(fmt.Sprintf("Additional key: %s\n", base64.StdEncoding.EncodeToString(k.PrivateKey)))
+	}
+	if d.UsesDerivation() {
+		b.WriteString(fmt.Sprintf("Symmetric key: %s\n", base64.StdEncoding.EncodeToString(d.SymmetricKey)))
+		b.WriteString(fmt.Sprintf("Derivation start: %s\n", d.DerivationStart.UTC().Format(time.RFC3339)))
+		b.WriteString(fmt.Sprintf("Update interval: %s\n", d.UpdateInterval))
+	}
+	if !d.Created.IsZero() {
+		b.WriteString(fmt.Sprintf("Created: %s\n", d.Created.UTC().Format(time.RFC3339)))
+	}
+	for _, meta := range [][2]string{{"Target", d.Target}, {"Notes", d.Notes}, {"Icon", d.Icon}, {"Color", d.Color}} {
+		if val := strings.Join(strings.Fields(meta[1]), " "); val != "" {
+			b.WriteString(fmt.Sprintf("%s: %s\n", meta[0], val))
+		}
+	}
+
+	data := []byte(b.String())
+	if d.Encrypted {
+		passphrase, err := Passphrase(true)
+		if err != nil {
+			return err
+		}
+		if data, err = Encrypt(data, passphrase); err != nil {
+			return fmt.Errorf("failed to encrypt keys: %w", err)
+		}
+	}
+
+	// write a temporary file and rename it over the keys file, so existing keys are never lost to a failed write
+	f, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := os.Rename(f.Name(), fileName); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
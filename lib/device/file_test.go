@@ -0,0 +1,74 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+func TestSaveLoadDerived(t *testing.T) {
+	d, err := GenerateDerived(filepath.Join(t.TempDir(), "test"), time.Now(), findmy.KeyUpdateInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadFromFile(d.Name + ".keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "test" {
+		t.Errorf("expected name test, got %s", loaded.Name)
+	}
+	if loaded.ID != d.ID || loaded.AdvertisementKey != d.AdvertisementKey || !bytes.Equal(loaded.PrivateKey, d.PrivateKey) {
+		t.Errorf("loaded keys do not match saved keys")
+	}
+	if !bytes.Equal(loaded.SymmetricKey, d.SymmetricKey) || !loaded.DerivationStart.Equal(d.DerivationStart) || loaded.UpdateInterval != d.UpdateInterval {
+		t.Errorf("loaded derivation parameters do not match saved parameters")
+	}
+}
+
+func TestAdditionalKeys(t *testing.T) {
+	d, err := Generate(filepath.Join(t.TempDir(), "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddKeys(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadFromFile(d.Name + ".keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loaded.KeysBetween(time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0].ID != d.ID {
+		t.Fatalf("expected master key and 2 additional keys, got %d", len(keys))
+	}
+	for i, k := range d.AdditionalKeys {
+		if keys[i+1].ID != k.ID || keys[i+1].AdvertisementKey != k.AdvertisementKey || !bytes.Equal(keys[i+1].PrivateKey, k.PrivateKey) {
+			t.Errorf("additional key %d does not match saved key", i)
+		}
+	}
+
+	derived, err := GenerateDerived("derived", time.Now(), findmy.KeyUpdateInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := derived.AddKeys(1); err == nil {
+		t.Errorf("expected error adding keys to a derived device")
+	}
+}
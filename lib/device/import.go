@@ -0,0 +1,54 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ImportFile imports the accessories of an OpenHaystack or macless-haystack export, in JSON or plist format.
+func ImportFile(fileName string) ([]Device, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+
+	var devices []Device
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		devices, err = ImportPlist(bytes.NewReader(data))
+	} else {
+		devices, err = ImportJSON(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to import file (%s): %w", fileName, err)
+	}
+	return devices, nil
+}
+
+// ImportJSON imports the accessories of a macless-haystack or OpenHaystack JSON export, see UnmarshalAccessories.
+func ImportJSON(r io.Reader) ([]Device, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalAccessories(data)
+}
+
+// ImportPlist imports the accessories of an OpenHaystack plist export.
+func ImportPlist(r io.Reader) ([]Device, error) {
+	value, err := decodePlist(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode plist: %w", err)
+	}
+
+	// convert to JSON, so plist and JSON exports are imported the same way
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalAccessories(data)
+}
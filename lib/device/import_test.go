@@ -0,0 +1,129 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportJSON(t *testing.T) {
+	d, err := Generate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddKeys(1); err != nil {
+		t.Fatal(err)
+	}
+	privateKey := base64.StdEncoding.EncodeToString(d.PrivateKey)
+	additionalKey := base64.StdEncoding.EncodeToString(d.AdditionalKeys[0].PrivateKey)
+
+	// as exported by macless-haystack
+	export := fmt.Sprintf(`[
+    {
+        "id": 123456,
+        "colorComponents": [1, 0.5, 0, 1],
+        "name": "Backpack",
+        "privateKey": %q,
+        "icon": "backpack",
+        "isDeployed": true,
+        "colorSpaceName": "kCGColorSpaceExtendedSRGB",
+        "usesDerivation": false,
+        "isActive": false,
+        "additionalKeys": [%q]
+    },
+    {
+        "id": 654321,
+        "name": "",
+        "privateKey": %q
+    }
+]`, privateKey, additionalKey, privateKey)
+
+	devices, err := ImportJSON(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+	imported := devices[0]
+	if imported.Name != "Backpack" || imported.Icon != "backpack" || imported.Color != "#ff8000" {
+		t.Errorf("unexpected metadata %s %s %s", imported.Name, imported.Icon, imported.Color)
+	}
+	if imported.ID != d.ID || imported.AdvertisementKey != d.AdvertisementKey || !bytes.Equal(imported.PrivateKey, d.PrivateKey) {
+		t.Errorf("imported keys do not match")
+	}
+	if len(imported.AdditionalKeys) != 1 || imported.AdditionalKeys[0].ID != d.AdditionalKeys[0].ID {
+		t.Errorf("expected additional key to be imported")
+	}
+	if devices[1].Name != "654321" {
+		t.Errorf("expected unnamed accessory to be named by its ID, got %q", devices[1].Name)
+	}
+
+	rolling := fmt.Sprintf(`{"name": "rolling", "privateKey": %q, "usesDerivation": true}`, privateKey)
+	if _, err := ImportJSON(strings.NewReader(rolling)); err == nil {
+		t.Errorf("expected error for accessory using key derivation without symmetric key")
+	}
+	if _, err := ImportJSON(strings.NewReader(`{"name": "short", "privateKey": "AAAA"}`)); err == nil {
+		t.Errorf("expected error for invalid private key")
+	}
+}
+
+func TestImportPlist(t *testing.T) {
+	d, err := Generate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OpenHaystack stores the key pair as 0x04 || X || Y || D
+	keyPair := append(append([]byte{0x04}, make([]byte, 56)...), d.PrivateKey...)
+	encoded := base64.StdEncoding.EncodeToString(keyPair)
+
+	export := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<array>
+	<dict>
+		<key>colorComponents</key>
+		<array>
+			<real>0.0</real>
+			<real>0.0</real>
+			<real>1</real>
+			<real>1</real>
+		</array>
+		<key>icon</key>
+		<string>key.fill</string>
+		<key>id</key>
+		<integer>1234</integer>
+		<key>isActive</key>
+		<true/>
+		<key>name</key>
+		<string>Keys</string>
+		<key>privateKey</key>
+		<data>
+		%s
+		%s
+		</data>
+		<key>usesDerivation</key>
+		<false/>
+	</dict>
+</array>
+</plist>
+`, encoded[:60], encoded[60:])
+
+	devices, err := ImportPlist(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(devices))
+	}
+	if devices[0].Name != "Keys" || devices[0].Icon != "key.fill" || devices[0].Color != "#0000ff" {
+		t.Errorf("unexpected metadata %+v", devices[0])
+	}
+	if devices[0].ID != d.ID || !bytes.Equal(devices[0].PrivateKey, d.PrivateKey) {
+		t.Errorf("imported keys do not match")
+	}
+}
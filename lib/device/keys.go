@@ -0,0 +1,63 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// NewKey returns the advertisement key pair of a 28 byte private key.
+func NewKey(privateKey []byte) (*Key, error) {
+	if len(privateKey) != 28 {
+		return nil, fmt.Errorf("%w: private key must be 28 bytes long", findmy.ErrorInvalidPrivateKey)
+	}
+
+	publicKey := findmy.PublicKey(privateKey)
+	return &Key{
+		ID:               hashKey(publicKey),
+		AdvertisementKey: base64.StdEncoding.EncodeToString(publicKey),
+		PrivateKey:       privateKey,
+	}, nil
+}
+
+// HashedKey returns the hashed advertisement key, the ID reports of the base64 encoded advertisement key are
+// retrieved by, for devices known only by their advertisement key.
+func HashedKey(advertisementKey string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(advertisementKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode advertisement key: %w", err)
+	}
+	if len(key) != 28 {
+		return "", fmt.Errorf("invalid advertisement key length %d, expected 28", len(key))
+	}
+	return hashKey(key), nil
+}
+
+func hashKey(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// AddKeys generates n additional static keys the device rotates through.
+func (d *Device) AddKeys(n int) error {
+	if d.UsesDerivation() {
+		return errors.New("devices using key derivation can not have additional keys")
+	}
+
+	for i := 0; i < n; i++ {
+		k, err := Generate("")
+		if err != nil {
+			return err
+		}
+		d.AdditionalKeys = append(d.AdditionalKeys, *k.masterKey())
+	}
+	return nil
+}
+
+// StaticKeys returns the master key followed by the additional keys of the device, in the order they are advertised.
+func (d *Device) StaticKeys() []Key {
+	return append([]Key{*d.masterKey()}, d.AdditionalKeys...)
+}
@@ -0,0 +1,137 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedHeader is the first line of an encrypted keys file.
+const encryptedHeader = "Encrypted keys: v1"
+
+// scrypt parameters for new keys files, recommended for interactive logins. Files with weaker parameters
+// are rejected, so a tampered file can not make the key cheaper to guess.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	// scryptMaxN limits the memory a keys file can make scrypt use.
+	scryptMaxN = 1 << 22
+	saltSize   = 16
+)
+
+var (
+	ErrNoPassphrase    = errors.New("device: passphrase required for encrypted keys file")
+	ErrWrongPassphrase = errors.New("device: wrong passphrase or corrupted keys file")
+)
+
+// Passphrase returns the passphrase of encrypted keys files. It is called with confirm set when a new
+// encrypted file is saved, so an interactive implementation can ask twice.
+// Defaults to PassphraseFromEnvOrPrompt.
+var Passphrase func(confirm bool) ([]byte, error) = PassphraseFromEnvOrPrompt
+
+// IsEncrypted reports whether the keys file content is encrypted.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedHeader+"\n"))
+}
+
+// Encrypt encrypts the content of a keys file with a key derived from the passphrase using scrypt and AES-256-GCM.
+func Encrypt(plaintext, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newKeystoreCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, plaintext, []byte(encryptedHeader))
+
+	b := strings.Builder{}
+	b.WriteString(encryptedHeader + "\n")
+	b.WriteString(fmt.Sprintf("Scrypt: %d,%d,%d\n", scryptN, scryptR, scryptP))
+	b.WriteString(fmt.Sprintf("Salt: %s\n", base64.StdEncoding.EncodeToString(salt)))
+	b.WriteString(fmt.Sprintf("Nonce: %s\n", base64.StdEncoding.EncodeToString(nonce)))
+	b.WriteString(fmt.Sprintf("Data: %s\n", base64.StdEncoding.EncodeToString(ciphertext)))
+	return []byte(b.String()), nil
+}
+
+// Decrypt decrypts the content of a keys file encrypted with Encrypt.
+func Decrypt(data, passphrase []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("device: keys file is not encrypted")
+	}
+
+	var n, r, p int
+	var salt, nonce, ciphertext []byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		key, val, found := strings.Cut(scanner.Text(), ": ")
+		if !found {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "Scrypt":
+			_, err = fmt.Sscanf(val, "%d,%d,%d", &n, &r, &p)
+		case "Salt":
+			salt, err = base64.StdEncoding.DecodeString(val)
+		case "Nonce":
+			nonce, err = base64.StdEncoding.DecodeString(val)
+		case "Data":
+			ciphertext, err = base64.StdEncoding.DecodeString(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse encrypted keys file (%s): %w", key, err)
+		}
+	}
+	if n == 0 || len(salt) == 0 || len(ciphertext) == 0 {
+		return nil, errors.New("device: incomplete encrypted keys file")
+	}
+	if n < scryptN || n > scryptMaxN || r < scryptR || r > 64 || p < scryptP || p > 16 || len(salt) < saltSize {
+		return nil, fmt.Errorf("device: unsupported key derivation parameters %d,%d,%d", n, r, p)
+	}
+
+	aead, err := newKeystoreCipher(passphrase, salt, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("device: invalid nonce length " + strconv.Itoa(len(nonce)))
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(encryptedHeader))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newKeystoreCipher(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,80 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte("Private key: secret\n")
+	encrypted, err := Encrypt(plaintext, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || bytes.Contains(encrypted, []byte("secret")) {
+		t.Fatalf("expected encrypted content, got %s", encrypted)
+	}
+
+	decrypted, err := Decrypt(encrypted, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, decrypted)
+	}
+	if _, err := Decrypt(encrypted, []byte("wrong")); err != ErrWrongPassphrase {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	// a tampered file must not downgrade the key derivation
+	for _, params := range []string{"1024,8,1", "32768,1,1", "1073741824,8,1"} {
+		tampered := bytes.Replace(encrypted, []byte("Scrypt: 32768,8,1"), []byte("Scrypt: "+params), 1)
+		if _, err := Decrypt(tampered, []byte("passphrase")); err == nil || err == ErrWrongPassphrase {
+			t.Errorf("expected parameters %s to be rejected, got %v", params, err)
+		}
+	}
+}
+
+func TestSaveLoadEncrypted(t *testing.T) {
+	passphrase := Passphrase
+	defer func() { Passphrase = passphrase }()
+	Passphrase = func(bool) ([]byte, error) { return []byte("passphrase"), nil }
+
+	d, err := Generate(filepath.Join(t.TempDir(), "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Encrypted = true
+	if err := d.SaveToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(d.Name + ".keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(data) || bytes.Contains(data, []byte(d.AdvertisementKey)) {
+		t.Errorf("expected keys file to be encrypted")
+	}
+	if info, err := os.Stat(d.Name + ".keys"); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected keys file to be only readable by the owner")
+	}
+
+	loaded, err := LoadFromFile(d.Name + ".keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Encrypted || loaded.ID != d.ID || !bytes.Equal(loaded.PrivateKey, d.PrivateKey) {
+		t.Errorf("loaded keys do not match saved keys")
+	}
+
+	Passphrase = func(bool) ([]byte, error) { return nil, ErrNoPassphrase }
+	if _, err := LoadFromFile(d.Name + ".keys"); !errors.Is(err, ErrNoPassphrase) {
+		t.Errorf("expected ErrNoPassphrase, got %v", err)
+	}
+}
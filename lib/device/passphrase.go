@@ -0,0 +1,65 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is the environment variable PassphraseFromEnvOrPrompt reads the passphrase from.
+const PassphraseEnv = "HAYSTACK_PASSPHRASE"
+
+var (
+	passphraseMu     sync.Mutex
+	cachedPassphrase []byte
+)
+
+// PassphraseFromEnvOrPrompt returns the passphrase from the HAYSTACK_PASSPHRASE environment variable,
+// or asks for it on the terminal. An entered passphrase is remembered until the program exits.
+func PassphraseFromEnvOrPrompt(confirm bool) ([]byte, error) {
+	if p, ok := os.LookupEnv(PassphraseEnv); ok {
+		return []byte(p), nil
+	}
+
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+	if cachedPassphrase != nil {
+		return cachedPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w: set %s", ErrNoPassphrase, PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase for keys: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(p) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		repeated, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(p, repeated) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	cachedPassphrase = p
+	return p, nil
+}
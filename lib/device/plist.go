@@ -0,0 +1,133 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodePlist decodes an XML property list into the values encoding/json uses: map[string]any, []any, string,
+// int64, float64 and bool. Data is returned base64 encoded and dates in seconds since the Apple reference date,
+// the way OpenHaystack encodes them in JSON.
+func decodePlist(r io.Reader) (any, error) {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("no plist element")
+			}
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "plist" {
+			value, err := decodePlistNext(d)
+			if errors.Is(err, endOfContainer) {
+				return nil, errors.New("empty plist")
+			}
+			return value, err
+		}
+	}
+}
+
+// endOfContainer marks the end element of a dict, array or the plist.
+var endOfContainer = errors.New("end of container")
+
+// decodePlistNext decodes the next value, returning endOfContainer at an end element.
+func decodePlistNext(d *xml.Decoder) (any, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return decodePlistValue(d, t)
+		case xml.EndElement:
+			return nil, endOfContainer
+		}
+	}
+}
+
+func decodePlistValue(d *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]any{}
+		for {
+			keyValue, err := decodePlistNext(d)
+			if errors.Is(err, endOfContainer) {
+				return dict, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyValue.(plistKey)
+			if !ok {
+				return nil, errors.New("dict value without key")
+			}
+			value, err := decodePlistNext(d)
+			if err != nil {
+				return nil, fmt.Errorf("value of key %s: %w", key, err)
+			}
+			dict[string(key)] = value
+		}
+	case "array":
+		array := []any{}
+		for {
+			value, err := decodePlistNext(d)
+			if errors.Is(err, endOfContainer) {
+				return array, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+
+	switch start.Name.Local {
+	case "key":
+		return plistKey(text), nil
+	case "string":
+		return text, nil
+	case "date":
+		date, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date: %w", err)
+		}
+		return date.Sub(appleReferenceDate).Seconds(), nil
+	case "integer":
+		return strconv.ParseInt(text, 10, 64)
+	case "real":
+		return strconv.ParseFloat(text, 64)
+	case "data":
+		// data is base64 encoded and may be split over several lines
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %w", err)
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported plist element %s", start.Name.Local)
+	}
+}
+
+// plistKey is the key of a dict entry.
+type plistKey string
@@ -0,0 +1,142 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RegistryEnv is the environment variable overriding the default registry directory.
+const RegistryEnv = "HAYSTACK_DIR"
+
+var (
+	ErrNotFound    = errors.New("device: not found")
+	ErrExists      = errors.New("device: already exists")
+	ErrInvalidName = errors.New("device: invalid name")
+)
+
+// Registry is a directory holding the keys files of devices, NAME.keys, and the files exported for them.
+type Registry struct {
+	Dir string
+}
+
+// DefaultRegistryDir returns $HAYSTACK_DIR, or the haystack directory in the user configuration directory,
+// such as ~/.config/haystack on Linux.
+func DefaultRegistryDir() (string, error) {
+	if dir := os.Getenv(RegistryEnv); dir != "" {
+		return dir, nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "haystack"), nil
+}
+
+// OpenRegistry opens the registry in the directory, creating the directory if needed.
+func OpenRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory (%s): %w", dir, err)
+	}
+	return &Registry{Dir: dir}, nil
+}
+
+// Path returns the path of a file of the device with the extension, such as ".keys".
+func (r *Registry) Path(name, ext string) string {
+	return filepath.Join(r.Dir, name+ext)
+}
+
+// List returns all devices in the registry, sorted by name.
+func (r *Registry) List() ([]Device, error) {
+	return LoadFromDir(r.Dir)
+}
+
+// Get loads the device.
+func (r *Registry) Get(name string) (*Device, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(r.Path(name, ".keys")); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return LoadFromFile(r.Path(name, ".keys"))
+}
+
+// Add saves a new device, it never overwrites an existing one. The creation time is set if it is not set yet.
+func (r *Registry) Add(d *Device) error {
+	if err := checkName(d.Name); err != nil {
+		return err
+	}
+	if d.Created.IsZero() {
+		d.Created = time.Now().Truncate(time.Second)
+	}
+
+	// create the file exclusively so concurrent adds can not overwrite each other
+	f, err := os.OpenFile(r.Path(d.Name, ".keys"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, d.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	f.Close()
+
+	if err := d.SaveAs(r.Path(d.Name, ".keys")); err != nil {
+		os.Remove(r.Path(d.Name, ".keys"))
+		return err
+	}
+	return nil
+}
+
+// Update saves an existing device.
+func (r *Registry) Update(d *Device) error {
+	if err := checkName(d.Name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(r.Path(d.Name, ".keys")); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, d.Name)
+	}
+	return d.SaveAs(r.Path(d.Name, ".keys"))
+}
+
+// Replace saves the device, replacing the keys of an existing device with the same name. The existing keys file
+// is replaced only once the new one is written, so it is kept if saving fails. The creation time is set if it is not set yet.
+func (r *Registry) Replace(d *Device) error {
+	if err := checkName(d.Name); err != nil {
+		return err
+	}
+	if d.Created.IsZero() {
+		d.Created = time.Now().Truncate(time.Second)
+	}
+	return d.SaveAs(r.Path(d.Name, ".keys"))
+}
+
+// Remove removes the keys file of the device and the files exported for it.
+func (r *Registry) Remove(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(r.Path(name, ".keys")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return err
+	}
+	if err := os.Remove(r.Path(name, ".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checkName checks that the device name can be used as a file name in the registry.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+//go:build !tinygo
+
+package device
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := OpenRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Target = "nano-rp2040"
+	d.Notes = "in the front\npocket"
+	d.Color = "#ff0000"
+	if err := r.Add(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Created.IsZero() {
+		t.Errorf("expected creation time to be set")
+	}
+
+	other, err := Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(other); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+
+	loaded, err := r.Get("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID != d.ID || loaded.Target != d.Target || loaded.Color != d.Color || !loaded.Created.Equal(d.Created) {
+		t.Errorf("loaded device does not match saved device: %+v", loaded)
+	}
+	if loaded.Notes != "in the front pocket" {
+		t.Errorf("expected notes on a single line, got %q", loaded.Notes)
+	}
+
+	loaded.Target = "xiao-ble"
+	if err := r.Update(loaded); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Target != "xiao-ble" || devices[0].ID != d.ID {
+		t.Errorf("expected updated device, got %+v", devices)
+	}
+
+	if err := r.Remove("bag"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get("bag"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := r.Remove("bag"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := r.Get("../bag"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("expected ErrInvalidName, got %v", err)
+	}
+	if err := r.Update(&Device{Name: "missing", Created: time.Now()}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	dir := t.TempDir()
+	r, err := OpenRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(d); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed save keeps the existing keys
+	passphrase := Passphrase
+	defer func() { Passphrase = passphrase }()
+	Passphrase = func(bool) ([]byte, error) { return nil, ErrNoPassphrase }
+	other, err := Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Encrypted = true
+	if err := r.Replace(other); !errors.Is(err, ErrNoPassphrase) {
+		t.Fatalf("expected ErrNoPassphrase, got %v", err)
+	}
+	if loaded, err := r.Get("bag"); err != nil || loaded.ID != d.ID {
+		t.Fatalf("expected the existing keys to be kept, got %v", err)
+	}
+
+	other.Encrypted = false
+	if err := r.Replace(other); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := r.Get("bag"); err != nil || loaded.ID != other.ID {
+		t.Fatalf("expected the keys to be replaced, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Errorf("expected only the keys file, got %v", files)
+	}
+}
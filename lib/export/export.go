@@ -0,0 +1,265 @@
+// Package export writes device reports in common geographic formats:
+// GPX tracks, KML placemarks and GeoJSON feature collections.
+package export
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatGPX     Format = "gpx"
+	FormatKML     Format = "kml"
+	FormatGeoJSON Format = "geojson"
+)
+
+// Formats lists all supported export formats.
+var Formats = []Format{FormatGPX, FormatKML, FormatGeoJSON}
+
+// Write writes the reports in the given format. Devices are used to name the tracks,
+// reports of unknown devices are named by their ID.
+func Write(w io.Writer, format Format, devices []device.Device, r reports.Reports) error {
+	switch format {
+	case FormatGPX:
+		return WriteGPX(w, devices, r)
+	case FormatKML:
+		return WriteKML(w, devices, r)
+	case FormatGeoJSON:
+		return WriteGeoJSON(w, devices, r)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// track is the time ordered list of reports of a single device.
+type track struct {
+	id      string
+	name    string
+	reports []reports.Report
+}
+
+// tracks returns the reports grouped by device, ordered by device name and location timestamp.
+func tracks(devices []device.Device, r reports.Reports) []track {
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.ID] = d.Name
+	}
+
+	result := make([]track, 0, len(r))
+	for id, rs := range r {
+		name, ok := names[id]
+		if !ok {
+			name = id
+		}
+		sorted := slices.Clone(rs)
+		slices.SortStableFunc(sorted, func(a, b reports.Report) int {
+			return a.Data.Timestamp.Compare(b.Data.Timestamp)
+		})
+		result = append(result, track{id: id, name: name, reports: sorted})
+	}
+	slices.SortFunc(result, func(a, b track) int {
+		return cmp.Or(cmp.Compare(a.name, b.name), cmp.Compare(a.id, b.id))
+	})
+	return result
+}
+
+// Namespace of the report properties in GPX extensions.
+const gpxNamespace = "https://github.com/HattoriHanzo031/go-haystack"
+
+type gpx struct {
+	XMLName  xml.Name   `xml:"gpx"`
+	Version  string     `xml:"version,attr"`
+	Creator  string     `xml:"creator,attr"`
+	Xmlns    string     `xml:"xmlns,attr"`
+	Haystack string     `xml:"xmlns:haystack,attr"`
+	Tracks   []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name"`
+	Comment string     `xml:"cmt"`
+	Segment []gpxTrkPt `xml:"trkseg>trkpt"`
+}
+
+type gpxTrkPt struct {
+	Lat        float64       `xml:"lat,attr"`
+	Lon        float64       `xml:"lon,attr"`
+	Time       string        `xml:"time"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+type gpxExtensions struct {
+	Accuracy   uint8  `xml:"haystack:accuracy"`
+	Confidence uint8  `xml:"haystack:confidence"`
+	Status     uint8  `xml:"haystack:status"`
+	Published  string `xml:"haystack:published"`
+}
+
+// WriteGPX writes the reports as GPX 1.1 with a track for each device.
+// Accuracy, confidence, status and publish date are stored as track point extensions.
+func WriteGPX(w io.Writer, devices []device.Device, r reports.Reports) error {
+	doc := gpx{
+		Version:  "1.1",
+		Creator:  "go-haystack",
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		Haystack: gpxNamespace,
+	}
+	for _, t := range tracks(devices, r) {
+		trk := gpxTrack{Name: t.name, Comment: t.id}
+		for _, report := range t.reports {
+			trk.Segment = append(trk.Segment, gpxTrkPt{
+				Lat:  report.Data.Latitude,
+				Lon:  report.Data.Longitude,
+				Time: formatTime(report.Data.Timestamp),
+				Extensions: gpxExtensions{
+					Accuracy:   report.Data.AccuracyMeters,
+					Confidence: report.Data.ConfidencePercent,
+					Status:     report.Data.Status,
+					Published:  formatTime(report.DatePublished),
+				},
+			})
+		}
+		doc.Tracks = append(doc.Tracks, trk)
+	}
+	return writeXML(w, doc)
+}
+
+type kml struct {
+	XMLName xml.Name    `xml:"kml"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Name    string      `xml:"Document>name"`
+	Folders []kmlFolder `xml:"Document>Folder"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	When        string    `xml:"TimeStamp>when"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Coordinates string    `xml:"Point>coordinates"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// WriteKML writes the reports as KML with a folder of placemarks for each device.
+// Accuracy, confidence, status and publish date are stored as extended data.
+func WriteKML(w io.Writer, devices []device.Device, r reports.Reports) error {
+	doc := kml{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Name:  "go-haystack reports",
+	}
+	for _, t := range tracks(devices, r) {
+		folder := kmlFolder{Name: t.name}
+		for _, report := range t.reports {
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name: t.name,
+				When: formatTime(report.Data.Timestamp),
+				Data: []kmlData{
+					{Name: "id", Value: t.id},
+					{Name: "accuracy", Value: strconv.Itoa(int(report.Data.AccuracyMeters))},
+					{Name: "confidence", Value: strconv.Itoa(int(report.Data.ConfidencePercent))},
+					{Name: "status", Value: strconv.Itoa(int(report.Data.Status))},
+					{Name: "published", Value: formatTime(report.DatePublished)},
+				},
+				Coordinates: strconv.FormatFloat(report.Data.Longitude, 'f', -1, 64) + "," + strconv.FormatFloat(report.Data.Latitude, 'f', -1, 64),
+			})
+		}
+		doc.Folders = append(doc.Folders, folder)
+	}
+	return writeXML(w, doc)
+}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	Geometry   point             `json:"geometry"`
+	Properties featureProperties `json:"properties"`
+}
+
+type point struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type featureProperties struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Timestamp  string `json:"timestamp"`
+	Published  string `json:"published"`
+	Accuracy   uint8  `json:"accuracy"`
+	Confidence uint8  `json:"confidence"`
+	Status     uint8  `json:"status"`
+}
+
+// WriteGeoJSON writes the reports as a GeoJSON FeatureCollection of points.
+// Device, timestamps, accuracy, confidence and status are stored as feature properties.
+func WriteGeoJSON(w io.Writer, devices []device.Device, r reports.Reports) error {
+	doc := featureCollection{
+		Type:     "FeatureCollection",
+		Features: []feature{},
+	}
+	for _, t := range tracks(devices, r) {
+		for _, report := range t.reports {
+			doc.Features = append(doc.Features, feature{
+				Type: "Feature",
+				Geometry: point{
+					Type:        "Point",
+					Coordinates: [2]float64{report.Data.Longitude, report.Data.Latitude},
+				},
+				Properties: featureProperties{
+					ID:         t.id,
+					Name:       t.name,
+					Timestamp:  formatTime(report.Data.Timestamp),
+					Published:  formatTime(report.DatePublished),
+					Accuracy:   report.Data.AccuracyMeters,
+					Confidence: report.Data.ConfidencePercent,
+					Status:     report.Data.Status,
+				},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
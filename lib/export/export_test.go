@@ -0,0 +1,132 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+var (
+	testStart   = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	testDevices = []device.Device{{Name: "bike", ID: "b"}, {Name: "alpha", ID: "a"}}
+	testReports = reports.Reports{
+		"b": {
+			{DatePublished: testStart.Add(2 * time.Hour), Data: reports.PayloadData{Timestamp: testStart.Add(time.Hour), Latitude: 45.81, Longitude: 15.98, AccuracyMeters: 20, ConfidencePercent: 3}},
+			{DatePublished: testStart.Add(time.Hour), Data: reports.PayloadData{Timestamp: testStart, Latitude: 45.8, Longitude: 15.97, AccuracyMeters: 10, ConfidencePercent: 2}},
+		},
+		"a": {
+			{DatePublished: testStart, Data: reports.PayloadData{Timestamp: testStart, Latitude: -33.8688, Longitude: 151.2093, AccuracyMeters: 5, ConfidencePercent: 1, Status: 0x40}},
+		},
+		"unknown": {
+			{DatePublished: testStart, Data: reports.PayloadData{Timestamp: testStart, Latitude: 1, Longitude: 2}},
+		},
+	}
+)
+
+func TestWriteGPX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGPX, testDevices, testReports); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc gpx
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Tracks) != 3 {
+		t.Fatalf("expected 3 tracks, got %d", len(doc.Tracks))
+	}
+	if doc.Tracks[0].Name != "alpha" || doc.Tracks[1].Name != "bike" || doc.Tracks[2].Name != "unknown" {
+		t.Errorf("unexpected track order: %s, %s, %s", doc.Tracks[0].Name, doc.Tracks[1].Name, doc.Tracks[2].Name)
+	}
+
+	bike := doc.Tracks[1].Segment
+	if len(bike) != 2 {
+		t.Fatalf("expected 2 track points, got %d", len(bike))
+	}
+	if bike[0].Time != "2025-01-01T12:00:00Z" || bike[0].Lat != 45.8 || bike[0].Lon != 15.97 {
+		t.Errorf("unexpected first track point %+v", bike[0])
+	}
+
+	// extensions are namespaced, so they are decoded separately
+	var ext struct {
+		Points []struct {
+			Accuracy   uint8  `xml:"https://github.com/HattoriHanzo031/go-haystack accuracy"`
+			Confidence uint8  `xml:"https://github.com/HattoriHanzo031/go-haystack confidence"`
+			Published  string `xml:"https://github.com/HattoriHanzo031/go-haystack published"`
+		} `xml:"trk>trkseg>trkpt>extensions"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &ext); err != nil {
+		t.Fatal(err)
+	}
+	if len(ext.Points) != 4 {
+		t.Fatalf("expected 4 extensions, got %d", len(ext.Points))
+	}
+	if p := ext.Points[2]; p.Accuracy != 20 || p.Confidence != 3 || p.Published != "2025-01-01T14:00:00Z" {
+		t.Errorf("unexpected extensions %+v", p)
+	}
+}
+
+func TestWriteKML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatKML, testDevices, testReports); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc kml
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Folders) != 3 {
+		t.Fatalf("expected 3 folders, got %d", len(doc.Folders))
+	}
+
+	alpha := doc.Folders[0].Placemarks
+	if len(alpha) != 1 {
+		t.Fatalf("expected 1 placemark, got %d", len(alpha))
+	}
+	if alpha[0].Coordinates != "151.2093,-33.8688" {
+		t.Errorf("unexpected coordinates %s", alpha[0].Coordinates)
+	}
+	data := map[string]string{}
+	for _, d := range alpha[0].Data {
+		data[d.Name] = d.Value
+	}
+	if data["accuracy"] != "5" || data["confidence"] != "1" || data["status"] != "64" || data["id"] != "a" {
+		t.Errorf("unexpected extended data %v", data)
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGeoJSON, testDevices, testReports); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc featureCollection
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Type != "FeatureCollection" || len(doc.Features) != 4 {
+		t.Fatalf("expected FeatureCollection with 4 features, got %s with %d", doc.Type, len(doc.Features))
+	}
+
+	f := doc.Features[0]
+	if f.Geometry.Coordinates != [2]float64{151.2093, -33.8688} {
+		t.Errorf("unexpected coordinates %v", f.Geometry.Coordinates)
+	}
+	if f.Properties.Name != "alpha" || f.Properties.Timestamp != "2025-01-01T12:00:00Z" || f.Properties.Accuracy != 5 {
+		t.Errorf("unexpected properties %+v", f.Properties)
+	}
+}
+
+func TestWriteUnsupported(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, Format("csv"), nil, nil); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
@@ -76,8 +76,9 @@ func ParseData(mac bluetooth.MAC, data []byte) (byte, []byte, error) {
 	var key [28]byte
 	copy(key[6:], data[3:25])
 
-	// turn address into key bytes
-	key[0] = mac[5]
+	// turn address into key bytes, the two most significant bits of the key
+	// are replaced in the random static address so they are sent in the payload
+	key[0] = mac[5]&0x3f | data[25]<<6
 	key[1] = mac[4]
 	key[2] = mac[3]
 	key[3] = mac[2]
@@ -88,11 +89,12 @@ func ParseData(mac bluetooth.MAC, data []byte) (byte, []byte, error) {
 }
 
 // NewData creates the ManufacturerDataElement for the advertising data used by FindMy devices.
+// The status is one of the battery status values, such as StatusBatteryFull.
 // See https://adamcatley.com/AirTag.html#advertising-data
-func NewData(keyData []byte) bluetooth.ManufacturerDataElement {
+func NewData(keyData []byte, status byte) bluetooth.ManufacturerDataElement {
 	data := make([]byte, 0, 27)
 	data = append(data, PayloadTypeRegistered, PayloadLength)
-	data = append(data, StatusBatteryFull)
+	data = append(data, status)
 	data = append(data, keyData[6:]...)    // copy last 22 bytes of advertising key
 	data = append(data, (keyData[0] >> 6)) // first two bits of advertising key
 	data = append(data, Hint)
@@ -118,3 +120,32 @@ func BatteryStatus(status byte) string {
 		return "unknown"
 	}
 }
+
+// BatteryThresholds are the battery voltages in millivolts below which the battery is reported
+// as medium, low and critical.
+type BatteryThresholds struct {
+	Medium   uint16
+	Low      uint16
+	Critical uint16
+}
+
+// DefaultBatteryThresholds are suitable for a single cell LiPo battery.
+var DefaultBatteryThresholds = BatteryThresholds{
+	Medium:   3700,
+	Low:      3500,
+	Critical: 3300,
+}
+
+// Status returns the battery status for the battery voltage in millivolts.
+func (t BatteryThresholds) Status(millivolts uint16) byte {
+	switch {
+	case millivolts < t.Critical:
+		return StatusBatteryCritical
+	case millivolts < t.Low:
+		return StatusBatteryLow
+	case millivolts < t.Medium:
+		return StatusBatteryMedium
+	default:
+		return StatusBatteryFull
+	}
+}
@@ -8,9 +8,9 @@ import (
 
 func TestNewData(t *testing.T) {
 	key := []byte{0xce, 0x8b, 0xad, 0x5f, 0x8a, 0x02, 0x71, 0x53, 0x8f, 0xf5, 0xaf, 0xda, 0x87, 0x49, 0x8c, 0xb0, 0x67, 0xe9, 0xa0, 0x20, 0xd6, 0xe4, 0x16, 0x78, 0x01, 0xd5, 0x5d, 0x83}
-	data := NewData(key)
-	if data.Data[2] != StatusBatteryFull {
-		t.Errorf("expected 0x%02x, got 0x%02x", StatusBatteryFull, data.Data[2])
+	data := NewData(key, StatusBatteryLow)
+	if data.Data[2] != StatusBatteryLow {
+		t.Errorf("expected 0x%02x, got 0x%02x", StatusBatteryLow, data.Data[2])
 	}
 	if data.Data[3] != 0x71 {
 		t.Errorf("expected 0x71, got 0x%02x", data.Data[3])
@@ -23,7 +23,7 @@ func TestNewData(t *testing.T) {
 func TestParseData(t *testing.T) {
 	address := bluetooth.MAC{0x02, 0x8a, 0x5f, 0xad, 0x8b, 0xce}
 	startingkey := []byte{0xce, 0x8b, 0xad, 0x5f, 0x8a, 0x02, 0x71, 0x53, 0x8f, 0xf5, 0xaf, 0xda, 0x87, 0x49, 0x8c, 0xb0, 0x67, 0xe9, 0xa0, 0x20, 0xd6, 0xe4, 0x16, 0x78, 0x01, 0xd5, 0x5d, 0x83}
-	data := NewData(startingkey)
+	data := NewData(startingkey, StatusBatteryFull)
 	status, key, err := ParseData(address, data.Data)
 	if err != nil {
 		t.Fatal(err)
@@ -54,6 +54,27 @@ func TestBatteryStatus(t *testing.T) {
 	}
 }
 
+func TestBatteryThresholds(t *testing.T) {
+	tests := []struct {
+		millivolts uint16
+		want       byte
+	}{
+		{4200, StatusBatteryFull},
+		{3700, StatusBatteryFull},
+		{3699, StatusBatteryMedium},
+		{3500, StatusBatteryMedium},
+		{3400, StatusBatteryLow},
+		{3299, StatusBatteryCritical},
+		{0, StatusBatteryCritical},
+	}
+	for _, test := range tests {
+		got := DefaultBatteryThresholds.Status(test.millivolts)
+		if got != test.want {
+			t.Errorf("Status(%d) = 0x%02x, want 0x%02x", test.millivolts, got, test.want)
+		}
+	}
+}
+
 func bytesEqual(a, b []byte) bool {
 	if len(a) != len(b) {
 		return false
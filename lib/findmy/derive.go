@@ -0,0 +1,69 @@
+package findmy
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+)
+
+const (
+	// Interval after which an accessory near its owner rotates its advertisement key.
+	KeyUpdateInterval = 15 * time.Minute
+
+	// Length of the symmetric key used for key derivation
+	SymmetricKeyLength = 32
+)
+
+var ErrorInvalidPrivateKey = errors.New("findmy: invalid private key")
+
+// KDF is the ANSI X9.63 key derivation function with SHA-256 used by FindMy accessories.
+func KDF(secret, sharedInfo []byte, length int) []byte {
+	out := make([]byte, 0, length+sha256.Size)
+	var counter [4]byte
+	for i := uint32(1); len(out) < length; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(secret)
+		h.Write(counter[:])
+		h.Write(sharedInfo)
+		out = h.Sum(out)
+	}
+	return out[:length]
+}
+
+// NextSymmetricKey derives the symmetric key of the next period (SKi+1) from the current one (SKi).
+func NextSymmetricKey(symmetricKey []byte) []byte {
+	return KDF(symmetricKey, []byte("update"), SymmetricKeyLength)
+}
+
+// DerivePrivateKey derives the private key of a period from the master private key (d0)
+// and the symmetric key of that period (SKi) as di = d0 * ui + vi (mod n).
+// This is the key schedule described in Apple's Find My Network Accessory Specification.
+func DerivePrivateKey(masterKey, symmetricKey []byte) ([]byte, error) {
+	params := elliptic.P224().Params()
+
+	d0 := new(big.Int).SetBytes(masterKey)
+	if d0.Sign() == 0 || d0.Cmp(params.N) >= 0 {
+		return nil, ErrorInvalidPrivateKey
+	}
+
+	diversified := KDF(symmetricKey, []byte("diversify"), 72)
+	nMinusOne := new(big.Int).Sub(params.N, big.NewInt(1))
+	u := new(big.Int).SetBytes(diversified[:36])
+	u.Mod(u, nMinusOne).Add(u, big.NewInt(1))
+	v := new(big.Int).SetBytes(diversified[36:])
+	v.Mod(v, nMinusOne).Add(v, big.NewInt(1))
+
+	d := new(big.Int).Mul(d0, u)
+	d.Add(d, v).Mod(d, params.N)
+	return d.FillBytes(make([]byte, 28)), nil
+}
+
+// PublicKey returns the 28 byte advertisement key (x coordinate of the public key) for the private key.
+func PublicKey(privateKey []byte) []byte {
+	x, _ := elliptic.P224().ScalarBaseMult(privateKey)
+	return x.FillBytes(make([]byte, 28))
+}
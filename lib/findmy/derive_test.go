@@ -0,0 +1,18 @@
+package findmy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestKDF(t *testing.T) {
+	secret := []byte("secret")
+	want := sha256.Sum256(append(append(secret, 0, 0, 0, 1), "update"...))
+	if got := KDF(secret, []byte("update"), 32); !bytes.Equal(got, want[:]) {
+		t.Errorf("KDF = %x, want %x", got, want)
+	}
+	if got := KDF(secret, []byte("diversify"), 72); len(got) != 72 {
+		t.Errorf("expected 72 bytes, got %d", len(got))
+	}
+}
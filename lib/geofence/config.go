@@ -0,0 +1,169 @@
+package geofence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/notify"
+)
+
+// DefaultInterval is the default interval reports are checked at.
+const DefaultInterval = 15 * time.Minute
+
+// Duration is a time.Duration written as a string such as "30m" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule selects the events sent to notifiers. Empty lists match everything.
+type Rule struct {
+	// Devices are the names of the devices the rule applies to.
+	Devices []string `json:"devices,omitempty"`
+	// Zones are the names of the zones the rule applies to.
+	Zones []string `json:"zones,omitempty"`
+	// Events are the event types the rule applies to.
+	Events []EventType `json:"events,omitempty"`
+	// Notify are the names of the notifiers the events are sent to.
+	Notify []string `json:"notify,omitempty"`
+}
+
+// Matches reports whether the event is selected by the rule.
+func (r *Rule) Matches(e Event) bool {
+	return (len(r.Devices) == 0 || slices.Contains(r.Devices, e.Device)) &&
+		(len(r.Zones) == 0 || slices.Contains(r.Zones, e.Zone)) &&
+		(len(r.Events) == 0 || slices.Contains(r.Events, e.Type))
+}
+
+// NotifierConfig configures a notifier. Type selects the implementation, the other fields depend on it.
+// Types other than log and exec are configured as described in notify.Config.
+type NotifierConfig struct {
+	Type string `json:"type"`
+	notify.Config
+	// Format is the output format of log notifiers, text or json.
+	Format string `json:"format,omitempty"`
+	// Command is the program and arguments run by exec notifiers.
+	Command []string `json:"command,omitempty"`
+}
+
+// Config is a geofence rules file:
+//
+//	{
+//		"interval": "10m",
+//		"minConfidence": 50,
+//		"zones": [
+//			{"name": "home", "center": {"latitude": 45.815, "longitude": 15.982}, "radius": 150, "dwell": "1h"}
+//		],
+//		"notifiers": {"log": {"type": "log"}},
+//		"rules": [
+//			{"devices": ["bag"], "zones": ["home"], "events": ["exit"], "notify": ["log"]}
+//		]
+//	}
+//
+// Without rules, all events are sent to all notifiers.
+type Config struct {
+	// Interval is the interval reports are checked at, DefaultInterval if zero.
+	Interval Duration `json:"interval,omitempty"`
+	EvaluatorConfig
+	Zones     []Zone                    `json:"zones"`
+	Notifiers map[string]NotifierConfig `json:"notifiers,omitempty"`
+	Rules     []Rule                    `json:"rules,omitempty"`
+}
+
+// LoadConfig reads and validates a rules file.
+func LoadConfig(fileName string) (*Config, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file (%s): %w", fileName, err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse rules (%s): %w", fileName, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules (%s): %w", fileName, err)
+	}
+	return &c, nil
+}
+
+// Validate checks the zones and that rules only refer to existing zones, event types and notifiers.
+func (c *Config) Validate() error {
+	if len(c.Zones) == 0 {
+		return fmt.Errorf("no zones")
+	}
+	names := make(map[string]bool, len(c.Zones))
+	for i := range c.Zones {
+		if err := c.Zones[i].Validate(); err != nil {
+			return err
+		}
+		if names[c.Zones[i].Name] {
+			return fmt.Errorf("duplicate zone %s", c.Zones[i].Name)
+		}
+		names[c.Zones[i].Name] = true
+	}
+
+	for i, r := range c.Rules {
+		for _, z := range r.Zones {
+			if !names[z] {
+				return fmt.Errorf("rule %d: unknown zone %s", i+1, z)
+			}
+		}
+		for _, e := range r.Events {
+			if !slices.Contains(EventTypes, e) {
+				return fmt.Errorf("rule %d: unknown event %s", i+1, e)
+			}
+		}
+		for _, n := range r.Notify {
+			if _, ok := c.Notifiers[n]; !ok {
+				return fmt.Errorf("rule %d: unknown notifier %s", i+1, n)
+			}
+		}
+	}
+	return nil
+}
+
+// Route returns the names of the notifiers the event is sent to, each at most once.
+func (c *Config) Route(e Event) []string {
+	var all []string
+	for name := range c.Notifiers {
+		all = append(all, name)
+	}
+	slices.Sort(all)
+	if len(c.Rules) == 0 {
+		return all
+	}
+
+	var names []string
+	for _, r := range c.Rules {
+		if !r.Matches(e) {
+			continue
+		}
+		notify := r.Notify
+		if len(notify) == 0 {
+			notify = all
+		}
+		for _, n := range notify {
+			if !slices.Contains(names, n) {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,114 @@
+package geofence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rules = `{
+	"interval": "10m",
+	"minConfidence": 50,
+	"zones": [
+		{"name": "home", "center": {"latitude": 45.815, "longitude": 15.982}, "radius": 150, "dwell": "1h"},
+		{"name": "office", "polygon": [
+			{"latitude": 45.80, "longitude": 15.96},
+			{"latitude": 45.80, "longitude": 15.97},
+			{"latitude": 45.81, "longitude": 15.97}
+		]}
+	],
+	"notifiers": {
+		"log": {"type": "log"},
+		"phone": {"type": "exec", "command": ["notify-send", "haystack"]}
+	},
+	"rules": [
+		{"devices": ["bag"], "zones": ["home"], "events": ["exit"], "notify": ["phone"]},
+		{"events": ["exit", "enter"]}
+	]
+}`
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(c.Interval) != 10*time.Minute || c.MinConfidence != 50 || len(c.Zones) != 2 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if time.Duration(c.Zones[0].Dwell) != time.Hour {
+		t.Errorf("expected dwell of 1h, got %v", c.Zones[0].Dwell)
+	}
+
+	for _, tc := range []struct {
+		event Event
+		want  []string
+	}{
+		{Event{Type: Exit, Device: "bag", Zone: "home"}, []string{"phone", "log"}},
+		{Event{Type: Exit, Device: "keys", Zone: "home"}, []string{"log", "phone"}},
+		{Event{Type: Dwell, Device: "bag", Zone: "home"}, nil},
+	} {
+		if got := c.Route(tc.event); !slices.Equal(got, tc.want) {
+			t.Errorf("%v: expected notifiers %v, got %v", tc.event, tc.want, got)
+		}
+	}
+
+	invalid := strings.Replace(rules, `"notify": ["phone"]`, `"notify": ["email"]`, 1)
+	if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "unknown notifier email") {
+		t.Errorf("expected unknown notifier error, got %v", err)
+	}
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := NewLogNotifier(&buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), Event{Type: Enter, Device: "bag", Zone: "home"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"type":"enter"`) {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	bodies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer ts.Close()
+
+	var config NotifierConfig
+	if err := json.Unmarshal([]byte(`{"type": "webhook", "url": "`+ts.URL+`"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Event{Type: Exit, Device: "bag", Zone: "home", Latitude: 45.8, Longitude: 15.9}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-bodies; !strings.Contains(body, `"kind":"exit"`) || !strings.Contains(body, `"latitude":45.8`) {
+		t.Errorf("unexpected webhook body %s", body)
+	}
+}
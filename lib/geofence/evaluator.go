@@ -0,0 +1,190 @@
+package geofence
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+// EventType is the kind of a geofence event.
+type EventType string
+
+const (
+	// Enter is emitted when a device enters a zone.
+	Enter EventType = "enter"
+	// Exit is emitted when a device leaves a zone.
+	Exit EventType = "exit"
+	// Dwell is emitted once per stay when a device has been in a zone for the zone's dwell time.
+	Dwell EventType = "dwell"
+)
+
+// EventTypes lists all event types.
+var EventTypes = []EventType{Enter, Exit, Dwell}
+
+// Event is a device entering, leaving or staying in a zone.
+type Event struct {
+	Type     EventType `json:"type"`
+	Zone     string    `json:"zone"`
+	Device   string    `json:"device"`
+	DeviceID string    `json:"deviceId"`
+	// Time is the location timestamp of the report causing the event.
+	Time time.Time `json:"time"`
+	// Since is the time the device entered the zone for Exit and Dwell events.
+	Since     time.Time `json:"since"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Accuracy  uint8     `json:"accuracy"`
+}
+
+// String returns a short description of the event.
+func (e Event) String() string {
+	t := e.Time.Local().Format(time.DateTime)
+	switch e.Type {
+	case Enter:
+		return fmt.Sprintf("%s entered %s at %s", e.Device, e.Zone, t)
+	case Exit:
+		return fmt.Sprintf("%s left %s at %s after %s", e.Device, e.Zone, t, e.Time.Sub(e.Since).Round(time.Minute))
+	case Dwell:
+		return fmt.Sprintf("%s has been in %s since %s", e.Device, e.Zone, e.Since.Local().Format(time.DateTime))
+	default:
+		return fmt.Sprintf("%s %s %s at %s", e.Device, e.Type, e.Zone, t)
+	}
+}
+
+// EvaluatorConfig selects the reports the Evaluator uses.
+type EvaluatorConfig struct {
+	// MinConfidence ignores reports with a lower confidence.
+	MinConfidence uint8 `json:"minConfidence,omitempty"`
+	// MaxAccuracy ignores reports with a worse accuracy in meters, no limit if zero.
+	MaxAccuracy uint8 `json:"maxAccuracy,omitempty"`
+}
+
+// Evaluator tracks the devices in zones and returns events when they change.
+type Evaluator struct {
+	zones   []Zone
+	config  EvaluatorConfig
+	devices map[string]*deviceState
+}
+
+type deviceState struct {
+	last  time.Time
+	zones map[string]*zoneState
+}
+
+type zoneState struct {
+	inside  bool
+	since   time.Time
+	dwelled bool
+}
+
+// NewEvaluator creates an evaluator for the zones.
+func NewEvaluator(zones []Zone, config EvaluatorConfig) (*Evaluator, error) {
+	for i := range zones {
+		if err := zones[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Evaluator{
+		zones:   zones,
+		config:  config,
+		devices: make(map[string]*deviceState),
+	}, nil
+}
+
+// Evaluate processes the reports of the device in location timestamp order and returns the resulting events.
+// Reports not newer than the last evaluated report of the device are skipped, so the same reports can be
+// passed again. The first report placing the device clearly inside or outside a zone only sets its state.
+func (e *Evaluator) Evaluate(d *device.Device, rs []reports.Report) []Event {
+	state, ok := e.devices[d.ID]
+	if !ok {
+		state = &deviceState{zones: make(map[string]*zoneState)}
+		e.devices[d.ID] = state
+	}
+
+	sorted := slices.Clone(rs)
+	slices.SortStableFunc(sorted, func(a, b reports.Report) int {
+		return a.Data.Timestamp.Compare(b.Data.Timestamp)
+	})
+
+	var events []Event
+	for _, r := range sorted {
+		if !r.Data.Timestamp.After(state.last) {
+			continue
+		}
+		state.last = r.Data.Timestamp
+		if r.Data.ConfidencePercent < e.config.MinConfidence ||
+			(e.config.MaxAccuracy > 0 && r.Data.AccuracyMeters > e.config.MaxAccuracy) {
+			continue
+		}
+
+		p := Point{Latitude: r.Data.Latitude, Longitude: r.Data.Longitude}
+		for i := range e.zones {
+			z := &e.zones[i]
+			// the report has to be beyond the boundary by its accuracy, but at most by half the zone size
+			// so reports can still place a device inside small zones
+			margin := math.Min(float64(r.Data.AccuracyMeters), z.size()/2)
+			distance := z.Distance(p)
+			zs, known := state.zones[z.Name]
+			var inside bool
+			switch {
+			case distance <= -margin:
+				inside = true
+			case distance >= margin:
+				inside = false
+			case known:
+				// within the accuracy of the boundary, the device stays where it was
+				inside = zs.inside
+			default:
+				continue
+			}
+
+			event := Event{
+				Zone:      z.Name,
+				Device:    d.Name,
+				DeviceID:  d.ID,
+				Time:      r.Data.Timestamp,
+				Latitude:  r.Data.Latitude,
+				Longitude: r.Data.Longitude,
+				Accuracy:  r.Data.AccuracyMeters,
+			}
+			switch {
+			case !known:
+				state.zones[z.Name] = &zoneState{inside: inside, since: r.Data.Timestamp}
+			case inside && !zs.inside:
+				*zs = zoneState{inside: true, since: r.Data.Timestamp}
+				event.Type = Enter
+				events = append(events, event)
+			case !inside && zs.inside:
+				event.Type = Exit
+				event.Since = zs.since
+				events = append(events, event)
+				*zs = zoneState{inside: false, since: r.Data.Timestamp}
+			case inside && !zs.dwelled && z.Dwell > 0 && r.Data.Timestamp.Sub(zs.since) >= time.Duration(z.Dwell):
+				zs.dwelled = true
+				event.Type = Dwell
+				event.Since = zs.since
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+// Inside returns the names of the zones the device was in at its last evaluated report.
+func (e *Evaluator) Inside(deviceID string) []string {
+	state, ok := e.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, z := range e.zones {
+		if zs, ok := state.zones[z.Name]; ok && zs.inside {
+			names = append(names, z.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,109 @@
+package geofence
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+var home = Point{Latitude: 45.8150, Longitude: 15.9819}
+
+// offset returns the point meters north of p.
+func offset(p Point, meters float64) Point {
+	return Point{Latitude: p.Latitude + meters/earthRadius*180/math.Pi, Longitude: p.Longitude}
+}
+
+func report(ts time.Time, p Point, accuracy uint8) reports.Report {
+	return reports.Report{
+		Data: reports.PayloadData{
+			Timestamp:         ts,
+			Latitude:          p.Latitude,
+			Longitude:         p.Longitude,
+			AccuracyMeters:    accuracy,
+			ConfidencePercent: 100,
+		},
+	}
+}
+
+func TestZoneDistance(t *testing.T) {
+	circle := Zone{Name: "home", Center: &home, Radius: 100}
+	if d := circle.Distance(offset(home, 250)); math.Abs(d-150) > 0.5 {
+		t.Errorf("expected distance of 150m, got %f", d)
+	}
+	if !circle.Contains(offset(home, 50)) {
+		t.Errorf("expected point inside circle")
+	}
+
+	// a square of about 200m around home
+	square := Zone{Name: "square", Polygon: []Point{
+		{Latitude: 45.8141, Longitude: 15.9806},
+		{Latitude: 45.8141, Longitude: 15.9832},
+		{Latitude: 45.8159, Longitude: 15.9832},
+		{Latitude: 45.8159, Longitude: 15.9806},
+	}}
+	if err := square.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if d := square.Distance(home); d > -90 || d < -110 {
+		t.Errorf("expected home about 100m inside the square, got %f", d)
+	}
+	if d := square.Distance(offset(home, 150)); d < 40 || d > 60 {
+		t.Errorf("expected point about 50m outside the square, got %f", d)
+	}
+	if s := square.size(); s < 100 || s > 125 {
+		t.Errorf("unexpected size of the square %f", s)
+	}
+
+	if err := (&Zone{Name: "line", Polygon: []Point{home, offset(home, 10)}}).Validate(); err == nil {
+		t.Errorf("expected error for polygon with 2 points")
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	e, err := NewEvaluator([]Zone{{Name: "home", Center: &home, Radius: 200, Dwell: Duration(time.Hour)}}, EvaluatorConfig{MinConfidence: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &device.Device{Name: "bag", ID: "a"}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	// the first report only sets the state
+	if events := e.Evaluate(d, []reports.Report{report(at(0), offset(home, 50), 20)}); len(events) != 0 {
+		t.Errorf("expected no events for the first report, got %v", events)
+	}
+
+	// close to the boundary within the accuracy, and an inaccurate report far outside, do not leave the zone
+	lowConfidence := report(at(20), offset(home, 2000), 10)
+	lowConfidence.Data.ConfidencePercent = 20
+	events := e.Evaluate(d, []reports.Report{report(at(10), offset(home, 230), 50), lowConfidence})
+	if len(events) != 0 {
+		t.Errorf("expected no events within the accuracy of the boundary, got %v", events)
+	}
+
+	events = e.Evaluate(d, []reports.Report{report(at(70), offset(home, 0), 10)})
+	if len(events) != 1 || events[0].Type != Dwell || !events[0].Since.Equal(at(0)) {
+		t.Fatalf("expected dwell event, got %v", events)
+	}
+
+	// reports are evaluated in order and old reports are skipped
+	events = e.Evaluate(d, []reports.Report{
+		report(at(100), offset(home, 100), 10),
+		report(at(90), offset(home, 400), 10),
+		report(at(70), offset(home, 400), 10),
+	})
+	if len(events) != 2 || events[0].Type != Exit || events[1].Type != Enter {
+		t.Fatalf("expected exit and enter events, got %v", events)
+	}
+	if events[0].Device != "bag" || events[0].Zone != "home" || !events[0].Since.Equal(at(0)) || !events[0].Time.Equal(at(90)) {
+		t.Errorf("unexpected exit event %+v", events[0])
+	}
+	if inside := e.Inside("a"); len(inside) != 1 || inside[0] != "home" {
+		t.Errorf("expected device inside home, got %v", inside)
+	}
+}
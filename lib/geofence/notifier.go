@@ -0,0 +1,112 @@
+package geofence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/notify"
+)
+
+// Notifier delivers events.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, e Event) error
+
+func (f NotifierFunc) Notify(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// NewNotifier creates a notifier of the types:
+//
+//   - log writes the events to stdout, as text or as one JSON object per line.
+//   - exec runs a command for each event, with the event as JSON on stdin and in the
+//     environment variables HAYSTACK_EVENT, HAYSTACK_DEVICE, HAYSTACK_ZONE and HAYSTACK_MESSAGE.
+//   - telegram, webhook, email, ntfy, gotify and mqtt send the events with notify.New.
+func NewNotifier(config NotifierConfig) (Notifier, error) {
+	switch config.Type {
+	case "log":
+		return NewLogNotifier(os.Stdout, config.Format)
+	case "exec":
+		if len(config.Command) == 0 {
+			return nil, fmt.Errorf("exec notifier without command")
+		}
+		return NewExecNotifier(config.Command), nil
+	default:
+		// the type of the embedded config is shadowed by Type
+		config.Config.Type = config.Type
+		n, err := notify.New(config.Config)
+		if err != nil {
+			return nil, err
+		}
+		return NotifierFunc(func(ctx context.Context, e Event) error {
+			return n.Notify(ctx, e.Message())
+		}), nil
+	}
+}
+
+// Message converts the event to a notification.
+func (e Event) Message() notify.Message {
+	return notify.Message{
+		Kind:     string(e.Type),
+		Device:   e.Device,
+		DeviceID: e.DeviceID,
+		Title:    fmt.Sprintf("%s %s %s", e.Device, e.Type, e.Zone),
+		Text:     e.String(),
+		Time:     e.Time,
+		Location: &notify.Location{Latitude: e.Latitude, Longitude: e.Longitude, Accuracy: float64(e.Accuracy)},
+	}
+}
+
+// NewLogNotifier returns a notifier writing events to w, as text or as one JSON object per line.
+func NewLogNotifier(w io.Writer, format string) (Notifier, error) {
+	var mu sync.Mutex
+	switch format {
+	case "", "text":
+		return NotifierFunc(func(ctx context.Context, e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			_, err := fmt.Fprintln(w, e)
+			return err
+		}), nil
+	case "json":
+		enc := json.NewEncoder(w)
+		return NotifierFunc(func(ctx context.Context, e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return enc.Encode(e)
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+}
+
+// NewExecNotifier returns a notifier running the command for each event, see NewNotifier.
+func NewExecNotifier(command []string) Notifier {
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Env = append(os.Environ(),
+			"HAYSTACK_EVENT="+string(e.Type),
+			"HAYSTACK_DEVICE="+e.Device,
+			"HAYSTACK_ZONE="+e.Zone,
+			"HAYSTACK_MESSAGE="+e.String(),
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %w: %s", command[0], err, bytes.TrimSpace(out))
+		}
+		return nil
+	})
+}
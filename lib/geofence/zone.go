@@ -0,0 +1,128 @@
+// Package geofence detects devices entering, leaving and staying in zones from their location reports.
+//
+// Zones are circles or polygons. Since reported locations are inaccurate, a device only changes between inside
+// and outside a zone when a report is beyond the zone boundary by its accuracy, so a device waiting at the
+// edge of a zone does not keep entering and leaving it.
+package geofence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371000
+
+// Point is a geographic location in degrees.
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Zone is a circle around Center with Radius, or a Polygon.
+type Zone struct {
+	Name string `json:"name"`
+	// Center and Radius in meters define a circular zone.
+	Center *Point  `json:"center,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+	// Polygon is the list of corners of a polygonal zone, without repeating the first one.
+	Polygon []Point `json:"polygon,omitempty"`
+	// Dwell is the time a device has to stay in the zone before a Dwell event, no Dwell events if zero.
+	Dwell Duration `json:"dwell,omitempty"`
+}
+
+// Validate checks that the zone is either a circle or a polygon.
+func (z *Zone) Validate() error {
+	if z.Name == "" {
+		return errors.New("zone without name")
+	}
+	switch {
+	case z.Center != nil && len(z.Polygon) > 0:
+		return fmt.Errorf("zone %s has both a center and a polygon", z.Name)
+	case z.Center != nil:
+		if z.Radius <= 0 {
+			return fmt.Errorf("zone %s has no radius", z.Name)
+		}
+	case len(z.Polygon) < 3:
+		return fmt.Errorf("zone %s needs a center and radius or a polygon of at least 3 points", z.Name)
+	}
+	return nil
+}
+
+// Distance returns the distance in meters from the point to the zone boundary, negative inside the zone.
+func (z *Zone) Distance(p Point) float64 {
+	if z.Center != nil {
+		return haversine(*z.Center, p) - z.Radius
+	}
+
+	// polygons are small enough to measure them on a plane tangent at the point
+	corners := make([][2]float64, len(z.Polygon))
+	for i, c := range z.Polygon {
+		corners[i] = planar(p, c)
+	}
+	distance := math.Inf(1)
+	inside := false
+	for i := range corners {
+		a, b := corners[i], corners[(i+1)%len(corners)]
+		distance = math.Min(distance, segmentDistance(a, b))
+		// ray casting along the positive x axis from the point at the origin
+		if (a[1] > 0) != (b[1] > 0) && a[0]+(0-a[1])*(b[0]-a[0])/(b[1]-a[1]) > 0 {
+			inside = !inside
+		}
+	}
+	if inside {
+		return -distance
+	}
+	return distance
+}
+
+// Contains reports whether the point is inside the zone.
+func (z *Zone) Contains(p Point) bool {
+	return z.Distance(p) <= 0
+}
+
+// size returns the radius of the zone, or of a circle with the area of the polygon.
+func (z *Zone) size() float64 {
+	if z.Center != nil {
+		return z.Radius
+	}
+	var area float64
+	for i := range z.Polygon {
+		a, b := planar(z.Polygon[0], z.Polygon[i]), planar(z.Polygon[0], z.Polygon[(i+1)%len(z.Polygon)])
+		area += a[0]*b[1] - b[0]*a[1]
+	}
+	return math.Sqrt(math.Abs(area) / 2 / math.Pi)
+}
+
+// haversine returns the great circle distance between the points in meters.
+func haversine(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// planar returns the position of p in meters east and north of the origin, on a plane tangent at the origin.
+func planar(origin, p Point) [2]float64 {
+	dLon := math.Remainder(p.Longitude-origin.Longitude, 360)
+	return [2]float64{
+		radians(dLon) * earthRadius * math.Cos(radians(origin.Latitude)),
+		radians(p.Latitude-origin.Latitude) * earthRadius,
+	}
+}
+
+// segmentDistance returns the distance from the origin to the segment ab.
+func segmentDistance(a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(a[0]*dx+a[1]*dy)/length))
+	}
+	return math.Hypot(a[0]+t*dx, a[1]+t*dy)
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,246 @@
+// Package history implements a persistent location history of device reports.
+//
+// Reports are kept in an append-only file with one JSON record per line and indexed in memory,
+// so history older than the macless-haystack server window is not lost between runs.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+// Store is an on-disk store of device reports.
+type Store struct {
+	mu      sync.Mutex
+	f       *os.File
+	reports reports.Reports
+	seen    map[string]struct{}
+}
+
+// Bounds is a geographic bounding box. West may be greater than East for boxes crossing the antimeridian.
+type Bounds struct {
+	South float64
+	West  float64
+	North float64
+	East  float64
+}
+
+// Query selects reports from the store. Zero values do not filter.
+type Query struct {
+	// DeviceIDs limits the results to the given devices.
+	DeviceIDs []string
+	// From and To limit the results to reports with a location timestamp in the range [From, To].
+	From time.Time
+	To   time.Time
+	// Bounds limits the results to reports located inside the box.
+	Bounds *Bounds
+}
+
+// record is a single line in the store file.
+type record struct {
+	ID     string         `json:"id"`
+	Report reports.Report `json:"report"`
+}
+
+// Open opens the store at path, creating it if it does not exist.
+// An incomplete last record left by an interrupted write is discarded.
+func Open(path string) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history (%s): %w", path, err)
+	}
+
+	s := &Store{
+		f:       f,
+		reports: make(reports.Reports),
+		seen:    make(map[string]struct{}),
+	}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load history (%s): %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	r := bufio.NewReader(s.f)
+	var offset int64
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(b) > 0 {
+				// drop the partially written record
+				if err := s.f.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(b))
+
+		var rec record
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("invalid record on line %d: %w", line, err)
+		}
+		s.insert(rec.ID, rec.Report)
+	}
+
+	for _, deviceReports := range s.reports {
+		sortReports(deviceReports)
+	}
+	_, err := s.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Add stores the reports that are not in the store yet and returns the number of added reports.
+// Reports are identified by device ID, location timestamp and payload data.
+func (s *Store) Add(deviceReports reports.Reports) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	var pending []record
+	keys := map[string]struct{}{}
+	for id, rs := range deviceReports {
+		for _, r := range rs {
+			key := reportKey(id, r)
+			if _, ok := s.seen[key]; ok {
+				continue
+			}
+			if _, ok := keys[key]; ok {
+				continue
+			}
+			keys[key] = struct{}{}
+			if err := enc.Encode(record{ID: id, Report: r}); err != nil {
+				return 0, fmt.Errorf("failed to encode report: %w", err)
+			}
+			pending = append(pending, record{ID: id, Report: r})
+		}
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	if err := s.write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	// the reports are indexed only once they are on disk, so a failed write can be retried
+	added := map[string]bool{}
+	for _, rec := range pending {
+		s.insert(rec.ID, rec.Report)
+		added[rec.ID] = true
+	}
+	for id := range added {
+		sortReports(s.reports[id])
+	}
+	return len(pending), nil
+}
+
+// write appends the records to the file. On failure the file is truncated back to its previous size,
+// so no partial record is left before the records of a later write, and errors doing so are returned too.
+func (s *Store) write(b []byte) error {
+	offset, err := s.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	_, err = s.f.Write(b)
+	if err == nil {
+		err = s.f.Sync()
+	}
+	if err != nil {
+		if terr := s.f.Truncate(offset); terr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to truncate partial write: %w", terr))
+		} else if _, serr := s.f.Seek(offset, io.SeekStart); serr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to seek back after partial write: %w", serr))
+		}
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Query returns the stored reports matching the query, ordered by location timestamp.
+func (s *Store) Query(q Query) reports.Reports {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := q.DeviceIDs
+	if len(ids) == 0 {
+		for id := range s.reports {
+			ids = append(ids, id)
+		}
+	}
+
+	result := make(reports.Reports)
+	for _, id := range ids {
+		for _, r := range s.reports[id] {
+			if !q.From.IsZero() && r.Data.Timestamp.Before(q.From) {
+				continue
+			}
+			if !q.To.IsZero() && r.Data.Timestamp.After(q.To) {
+				continue
+			}
+			if q.Bounds != nil && !q.Bounds.Contains(r.Data.Latitude, r.Data.Longitude) {
+				continue
+			}
+			result[id] = append(result[id], r)
+		}
+	}
+	return result
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// Contains reports whether the location is inside the bounding box.
+func (b Bounds) Contains(latitude, longitude float64) bool {
+	if latitude < b.South || latitude > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return longitude >= b.West && longitude <= b.East
+	}
+	return longitude >= b.West || longitude <= b.East
+}
+
+// insert adds the report to the index, it returns false if the report is already stored.
+func (s *Store) insert(id string, r reports.Report) bool {
+	key := reportKey(id, r)
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	s.seen[key] = struct{}{}
+	s.reports[id] = append(s.reports[id], r)
+	return true
+}
+
+func reportKey(id string, r reports.Report) string {
+	return fmt.Sprintf("%s|%d|%d|%d|%d|%d|%d", id, r.Data.Timestamp.Unix(),
+		int32(math.Round(r.Data.Latitude*10000000)), int32(math.Round(r.Data.Longitude*10000000)),
+		r.Data.AccuracyMeters, r.Data.ConfidencePercent, r.Data.Status)
+}
+
+func sortReports(rs []reports.Report) {
+	slices.SortStableFunc(rs, func(a, b reports.Report) int {
+		return a.Data.Timestamp.Compare(b.Data.Timestamp)
+	})
+}
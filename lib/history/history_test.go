@@ -0,0 +1,156 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+func report(ts time.Time, lat, lon float64) reports.Report {
+	return reports.Report{
+		DatePublished: ts.Add(time.Minute),
+		Data: reports.PayloadData{
+			Timestamp:      ts,
+			Latitude:       lat,
+			Longitude:      lon,
+			AccuracyMeters: 10,
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := s.Add(reports.Reports{
+		"a": {report(start.Add(time.Hour), 45.8, 15.9), report(start, 45.81, 15.97)},
+		"b": {report(start, 52.52, 13.4)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 3 {
+		t.Errorf("expected 3 added reports, got %d", added)
+	}
+
+	// the same reports again together with a new one
+	added, err = s.Add(reports.Reports{
+		"a": {report(start, 45.81, 15.97), report(start.Add(2*time.Hour), 45.82, 15.98)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Errorf("expected 1 added report, got %d", added)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	all := s.Query(Query{})
+	if len(all["a"]) != 3 || len(all["b"]) != 1 {
+		t.Fatalf("expected 3 and 1 reports after reopening, got %d and %d", len(all["a"]), len(all["b"]))
+	}
+	for i := 1; i < len(all["a"]); i++ {
+		if all["a"][i].Data.Timestamp.Before(all["a"][i-1].Data.Timestamp) {
+			t.Errorf("reports are not ordered by timestamp")
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		wantA int
+		wantB int
+	}{
+		{"device", Query{DeviceIDs: []string{"b"}}, 0, 1},
+		{"from", Query{From: start.Add(time.Hour)}, 2, 0},
+		{"to", Query{To: start}, 1, 1},
+		{"range", Query{From: start.Add(30 * time.Minute), To: start.Add(90 * time.Minute)}, 1, 0},
+		{"bounds", Query{Bounds: &Bounds{South: 45, West: 15, North: 46, East: 16}}, 3, 0},
+		{"antimeridian", Query{Bounds: &Bounds{South: 40, West: 170, North: 60, East: 14}}, 0, 1},
+	}
+	for _, test := range tests {
+		got := s.Query(test.query)
+		if len(got["a"]) != test.wantA || len(got["b"]) != test.wantB {
+			t.Errorf("%s: expected %d and %d reports, got %d and %d", test.name, test.wantA, test.wantB, len(got["a"]), len(got["b"]))
+		}
+	}
+}
+
+func TestStoreTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(reports.Reports{"a": {report(time.Now(), 1, 1)}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// simulate a write interrupted half way
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"a","report":{"Dat`)
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(reports.Reports{"a": {report(time.Now().Add(time.Hour), 2, 2)}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.Query(Query{}); len(got["a"]) != 2 {
+		t.Errorf("expected 2 reports, got %d", len(got["a"]))
+	}
+}
+
+func TestStoreAddRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// a read only file makes the write fail
+	f := s.f
+	if s.f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	rs := reports.Reports{"a": {report(time.Now(), 1, 1)}}
+	if _, err := s.Add(rs); err == nil {
+		t.Fatal("expected write error")
+	}
+	s.f.Close()
+	s.f = f
+
+	if n, err := s.Add(rs); err != nil || n != 1 {
+		t.Fatalf("expected the report to be added on retry, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,253 @@
+// Package homeassistant publishes devices to Home Assistant through MQTT discovery.
+//
+// Each device appears as a device_tracker entity with its last reported location and accuracy,
+// together with sensors for its battery status and the time of the report. Scanners receiving the
+// advertisements of the devices nearby add RSSI and presence sensors named after the scanner, so the
+// room a device is in can be inferred from the scanner with the strongest signal.
+package homeassistant
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+const (
+	// DefaultPrefix is the discovery prefix of Home Assistant.
+	DefaultPrefix = "homeassistant"
+	// DefaultTopic is the base topic the state of the devices is published under.
+	DefaultTopic = "haystack"
+)
+
+// Publisher publishes MQTT messages, such as an *mqtt.Client.
+type Publisher interface {
+	Publish(ctx context.Context, m mqtt.Message) error
+}
+
+// Config configures a Bridge.
+type Config struct {
+	// Prefix is the discovery prefix, DefaultPrefix if empty.
+	Prefix string
+	// Topic is the base topic, DefaultTopic if empty.
+	Topic string
+	// Scanner is the name of the local scanner, such as the room it is in. Sightings are
+	// only published if it is set.
+	Scanner string
+}
+
+// Bridge publishes the discovery configuration and state of devices.
+//
+// The state is published under the base topic:
+//
+//	haystack/status                        online or offline
+//	haystack/DEVICE/state                  last report as JSON: latitude, longitude, gps_accuracy, battery, timestamp
+//	haystack/DEVICE/SCANNER/rssi           signal strength of the last advertisement received by the scanner
+//	haystack/DEVICE/SCANNER/presence       ON while the scanner receives advertisements, OFF once it does not
+type Bridge struct {
+	pub    Publisher
+	config Config
+}
+
+// New creates a bridge publishing with pub.
+func New(pub Publisher, config Config) *Bridge {
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	if config.Topic == "" {
+		config.Topic = DefaultTopic
+	}
+	return &Bridge{pub: pub, config: config}
+}
+
+// AvailabilityTopic is the topic the availability of the bridge is published to.
+func (b *Bridge) AvailabilityTopic() string {
+	return b.config.Topic + "/status"
+}
+
+// Will is the last will to connect with, it marks the entities unavailable when the bridge is gone.
+func (b *Bridge) Will() *mqtt.Message {
+	return &mqtt.Message{Topic: b.AvailabilityTopic(), Payload: []byte("offline"), QoS: 1, Retain: true}
+}
+
+// Online marks the entities available.
+func (b *Bridge) Online(ctx context.Context) error {
+	return b.publish(ctx, b.AvailabilityTopic(), []byte("online"))
+}
+
+// ObjectID returns the ID of the device used in topics and entity IDs.
+// It is derived from the device ID, which may contain characters not allowed in topics.
+func ObjectID(d *device.Device) string {
+	if id, err := base64.StdEncoding.DecodeString(d.ID); err == nil && len(id) >= 8 {
+		return "haystack_" + hex.EncodeToString(id[:8])
+	}
+	return "haystack_" + sanitize(d.ID)
+}
+
+// entity is the discovery configuration of an entity.
+type entity struct {
+	Name                string       `json:"name"`
+	UniqueID            string       `json:"unique_id"`
+	ObjectID            string       `json:"object_id"`
+	StateTopic          string       `json:"state_topic,omitempty"`
+	JSONAttributesTopic string       `json:"json_attributes_topic,omitempty"`
+	ValueTemplate       string       `json:"value_template,omitempty"`
+	SourceType          string       `json:"source_type,omitempty"`
+	DeviceClass         string       `json:"device_class,omitempty"`
+	UnitOfMeasurement   string       `json:"unit_of_measurement,omitempty"`
+	StateClass          string       `json:"state_class,omitempty"`
+	Options             []string     `json:"options,omitempty"`
+	EntityCategory      string       `json:"entity_category,omitempty"`
+	Icon                string       `json:"icon,omitempty"`
+	AvailabilityTopic   string       `json:"availability_topic"`
+	Device              entityDevice `json:"device"`
+}
+
+type entityDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// Discover publishes the discovery configuration of the entities of the devices.
+// The configuration is retained, so it only needs to be published when the bridge starts.
+func (b *Bridge) Discover(ctx context.Context, devices []device.Device) error {
+	for i := range devices {
+		d := &devices[i]
+		id := ObjectID(d)
+		dev := entityDevice{Identifiers: []string{id}, Name: d.Name, Manufacturer: "go-haystack", Model: d.Target}
+		state := b.deviceTopic(d) + "/state"
+		entities := map[string]entity{
+			"device_tracker/" + id: {
+				Name:                "Location",
+				JSONAttributesTopic: state,
+				SourceType:          "gps",
+				Icon:                "mdi:map-marker",
+			},
+			"sensor/" + id + "_battery": {
+				Name:          "Battery",
+				StateTopic:    state,
+				ValueTemplate: "{{ value_json.battery }}",
+				DeviceClass:   "enum",
+				Options:       []string{"full", "medium", "low", "critical", "unknown"},
+				Icon:          "mdi:battery",
+			},
+			"sensor/" + id + "_last_report": {
+				Name:           "Last report",
+				StateTopic:     state,
+				ValueTemplate:  "{{ value_json.timestamp }}",
+				DeviceClass:    "timestamp",
+				EntityCategory: "diagnostic",
+			},
+		}
+		if b.config.Scanner != "" {
+			scanner := sanitize(b.config.Scanner)
+			entities["sensor/"+id+"_"+scanner+"_rssi"] = entity{
+				Name:              b.config.Scanner + " RSSI",
+				StateTopic:        b.scannerTopic(d) + "/rssi",
+				DeviceClass:       "signal_strength",
+				UnitOfMeasurement: "dBm",
+				StateClass:        "measurement",
+				EntityCategory:    "diagnostic",
+			}
+			entities["binary_sensor/"+id+"_"+scanner+"_presence"] = entity{
+				Name:        b.config.Scanner,
+				StateTopic:  b.scannerTopic(d) + "/presence",
+				DeviceClass: "presence",
+			}
+		}
+
+		for component, e := range entities {
+			_, objectID, _ := strings.Cut(component, "/")
+			e.UniqueID = objectID
+			e.ObjectID = objectID
+			e.AvailabilityTopic = b.AvailabilityTopic()
+			e.Device = dev
+			payload, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.publish(ctx, b.config.Prefix+"/"+component+"/config", payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// State is the state of a device published for its last report.
+type State struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// GPSAccuracy is the accuracy in meters, the name is the attribute Home Assistant expects.
+	GPSAccuracy int       `json:"gps_accuracy"`
+	Confidence  int       `json:"confidence"`
+	Battery     string    `json:"battery"`
+	Timestamp   time.Time `json:"timestamp"`
+	Published   time.Time `json:"published"`
+}
+
+// PublishReport publishes the location of the report as the state of the device.
+func (b *Bridge) PublishReport(ctx context.Context, d *device.Device, r reports.Report) error {
+	payload, err := json.Marshal(State{
+		Latitude:    r.Data.Latitude,
+		Longitude:   r.Data.Longitude,
+		GPSAccuracy: int(r.Data.AccuracyMeters),
+		Confidence:  int(r.Data.ConfidencePercent),
+		Battery:     findmy.BatteryStatus(r.Data.Status),
+		Timestamp:   r.Data.Timestamp,
+		Published:   r.DatePublished,
+	})
+	if err != nil {
+		return err
+	}
+	return b.publish(ctx, b.deviceTopic(d)+"/state", payload)
+}
+
+// PublishSighting publishes the signal strength of an advertisement of the device received by the scanner.
+func (b *Bridge) PublishSighting(ctx context.Context, d *device.Device, rssi int16) error {
+	if err := b.publish(ctx, b.scannerTopic(d)+"/rssi", []byte(strconv.Itoa(int(rssi)))); err != nil {
+		return err
+	}
+	return b.publish(ctx, b.scannerTopic(d)+"/presence", []byte("ON"))
+}
+
+// PublishAway publishes that the scanner does not receive advertisements of the device anymore.
+func (b *Bridge) PublishAway(ctx context.Context, d *device.Device) error {
+	return b.publish(ctx, b.scannerTopic(d)+"/presence", []byte("OFF"))
+}
+
+func (b *Bridge) deviceTopic(d *device.Device) string {
+	return b.config.Topic + "/" + ObjectID(d)
+}
+
+func (b *Bridge) scannerTopic(d *device.Device) string {
+	return b.deviceTopic(d) + "/" + sanitize(b.config.Scanner)
+}
+
+func (b *Bridge) publish(ctx context.Context, topic string, payload []byte) error {
+	if err := b.pub.Publish(ctx, mqtt.Message{Topic: topic, Payload: payload, QoS: 1, Retain: true}); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", topic, err)
+	}
+	return nil
+}
+
+// sanitize returns the name in lower case with characters not allowed in entity IDs replaced.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
@@ -0,0 +1,111 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt/fakebroker"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+func TestBridge(t *testing.T) {
+	d, err := device.Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker, err := fakebroker.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	b := New(nil, Config{Scanner: "Living Room"})
+	ctx := context.Background()
+	client, err := mqtt.Dial(ctx, broker.Addr(), mqtt.Options{Will: b.Will()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	b.pub = client
+
+	if err := b.Online(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Discover(ctx, []device.Device{*d}); err != nil {
+		t.Fatal(err)
+	}
+	id := ObjectID(d)
+
+	m, ok := broker.Retained("homeassistant/device_tracker/" + id + "/config")
+	if !ok {
+		t.Fatalf("no device tracker discovery for %s", id)
+	}
+	var tracker map[string]any
+	if err := json.Unmarshal(m.Payload, &tracker); err != nil {
+		t.Fatal(err)
+	}
+	if tracker["json_attributes_topic"] != "haystack/"+id+"/state" || tracker["availability_topic"] != "haystack/status" || tracker["unique_id"] != id {
+		t.Errorf("unexpected device tracker config %v", tracker)
+	}
+	for _, topic := range []string{
+		"homeassistant/sensor/" + id + "_battery/config",
+		"homeassistant/sensor/" + id + "_last_report/config",
+		"homeassistant/sensor/" + id + "_living_room_rssi/config",
+		"homeassistant/binary_sensor/" + id + "_living_room_presence/config",
+	} {
+		if _, ok := broker.Retained(topic); !ok {
+			t.Errorf("no discovery at %s", topic)
+		}
+	}
+
+	r := reports.Report{
+		DatePublished: time.Date(2025, 3, 1, 12, 5, 0, 0, time.UTC),
+		Data: reports.PayloadData{
+			Timestamp:      time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+			Latitude:       45.815,
+			Longitude:      15.982,
+			AccuracyMeters: 25,
+			Status:         findmy.StatusBatteryLow,
+		},
+	}
+	if err := b.PublishReport(ctx, d, r); err != nil {
+		t.Fatal(err)
+	}
+	m, _ = broker.Retained("haystack/" + id + "/state")
+	var state State
+	if err := json.Unmarshal(m.Payload, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Latitude != 45.815 || state.GPSAccuracy != 25 || state.Battery != "low" || !state.Timestamp.Equal(r.Data.Timestamp) {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	if err := b.PublishSighting(ctx, d, -67); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := broker.Retained("haystack/" + id + "/living_room/rssi"); string(m.Payload) != "-67" {
+		t.Errorf("expected rssi -67, got %q", m.Payload)
+	}
+	if err := b.PublishAway(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := broker.Retained("haystack/" + id + "/living_room/presence"); string(m.Payload) != "OFF" {
+		t.Errorf("expected presence OFF, got %q", m.Payload)
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	d := &device.Device{ID: "AAECAwQFBgcICQ=="}
+	if id := ObjectID(d); id != "haystack_0001020304050607" {
+		t.Errorf("unexpected object ID %s", id)
+	}
+	d.ID = "a+b/c"
+	if id := ObjectID(d); id != "haystack_a_b_c" {
+		t.Errorf("unexpected object ID %s", id)
+	}
+}
@@ -0,0 +1,217 @@
+// Package locate estimates the location of a device from its reports.
+//
+// The locations of reports are scattered around the real location by up to their accuracy, and
+// occasionally far off. Reports close in time are grouped into clusters, and the location of a
+// cluster is the average of its reports weighted by their accuracy, after rejecting the reports
+// that are too far from the others to be plausible.
+package locate
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+const (
+	// DefaultWindow is the default time span of a cluster.
+	DefaultWindow = 30 * time.Minute
+	// DefaultOutlierFactor is the default number of combined accuracies a report may be away
+	// from the estimate of the other reports before it is rejected.
+	DefaultOutlierFactor = 3
+	// MinAccuracy is the accuracy in meters assumed for reports claiming a better one,
+	// so a single report does not outweigh all others.
+	MinAccuracy = 5
+
+	earthRadius = 6371000.0
+)
+
+// Config configures the estimation. Zero values select the defaults.
+type Config struct {
+	// Window is the maximum time between the first and last report of a cluster.
+	Window time.Duration
+	// MinConfidence ignores reports with a lower confidence in percent.
+	MinConfidence uint8
+	// OutlierFactor rejects reports further from the estimate of the other reports than this many times
+	// the combined accuracy of the report and that estimate.
+	OutlierFactor float64
+}
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.OutlierFactor <= 0 {
+		c.OutlierFactor = DefaultOutlierFactor
+	}
+	return c
+}
+
+// Estimate is a location estimated from a cluster of reports.
+type Estimate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Radius is the uncertainty of the estimate in meters, the larger of the combined accuracy of the
+	// reports and the weighted spread of their locations around the estimate.
+	Radius float64 `json:"radius"`
+	// From and To are the location times of the oldest and newest report used.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Reports is the number of reports used and Rejected the number of reports rejected as outliers.
+	Reports  int `json:"reports"`
+	Rejected int `json:"rejected"`
+	// Latest is the newest report used, for its battery status and publish time.
+	Latest reports.Report `json:"-"`
+}
+
+// Best returns the estimate of the current location: the estimate of the reports within the window
+// before the newest report. If the newest report is rejected as an outlier, but it and at least one report
+// before it agree with each other, the device moved within the window and only those newest reports are
+// used, so a device that just moved is located at its new place while a single far off report is not
+// trusted. It returns false if there are no usable reports.
+func Best(rs []reports.Report, config Config) (Estimate, bool) {
+	config = config.withDefaults()
+	rs = usable(rs, config)
+	if len(rs) == 0 {
+		return Estimate{}, false
+	}
+	newest := rs[len(rs)-1]
+	start := newest.Data.Timestamp.Add(-config.Window)
+	i, _ := slices.BinarySearchFunc(rs, start, func(r reports.Report, t time.Time) int {
+		return r.Data.Timestamp.Compare(t)
+	})
+	window := rs[i:]
+
+	e := estimate(window, config)
+	if !e.To.Before(newest.Data.Timestamp) {
+		return e, true
+	}
+	// the newest reports agreeing with the newest one
+	moved := len(window) - 1
+	for moved > 0 && agree(window[moved-1], newest, config) {
+		moved--
+	}
+	if len(window)-moved < 2 {
+		return e, true
+	}
+	e = estimate(window[moved:], config)
+	e.Rejected += moved
+	return e, true
+}
+
+// Clusters splits the reports into clusters spanning at most the window, in time order,
+// and returns the estimate of each.
+func Clusters(rs []reports.Report, config Config) []Estimate {
+	config = config.withDefaults()
+	rs = usable(rs, config)
+	var estimates []Estimate
+	for start := 0; start < len(rs); {
+		end := start + 1
+		for end < len(rs) && rs[end].Data.Timestamp.Sub(rs[start].Data.Timestamp) <= config.Window {
+			end++
+		}
+		estimates = append(estimates, estimate(rs[start:end], config))
+		start = end
+	}
+	return estimates
+}
+
+// usable returns the reports with sufficient confidence, ordered by location time.
+func usable(rs []reports.Report, config Config) []reports.Report {
+	rs = slices.DeleteFunc(slices.Clone(rs), func(r reports.Report) bool {
+		return r.Data.ConfidencePercent < config.MinConfidence
+	})
+	slices.SortStableFunc(rs, func(a, b reports.Report) int {
+		return a.Data.Timestamp.Compare(b.Data.Timestamp)
+	})
+	return rs
+}
+
+// point is a report projected onto a plane tangent to the earth around the first report, in meters.
+type point struct {
+	x, y   float64
+	sigma  float64
+	report reports.Report
+}
+
+// newPoint projects the report onto the plane tangent to the earth at lat0, lon0.
+func newPoint(r reports.Report, lat0, lon0, scale float64) point {
+	return point{
+		x:      (r.Data.Longitude - lon0) * math.Pi / 180 * earthRadius * scale,
+		y:      (r.Data.Latitude - lat0) * math.Pi / 180 * earthRadius,
+		sigma:  max(float64(r.Data.AccuracyMeters), MinAccuracy),
+		report: r,
+	}
+}
+
+// agree reports whether two reports are within the outlier distance of each other.
+func agree(a, b reports.Report, config Config) bool {
+	scale := math.Cos(a.Data.Latitude * math.Pi / 180)
+	p := newPoint(b, a.Data.Latitude, a.Data.Longitude, scale)
+	sigma := max(float64(a.Data.AccuracyMeters), MinAccuracy)
+	return math.Hypot(p.x, p.y) <= config.OutlierFactor*math.Hypot(p.sigma, sigma)
+}
+
+// estimate computes the estimate of a cluster. Outliers are rejected one at a time, the worst first, as long
+// as more than two reports remain, since of two disagreeing reports neither can be preferred.
+func estimate(rs []reports.Report, config Config) Estimate {
+	lat0, lon0 := rs[0].Data.Latitude, rs[0].Data.Longitude
+	scale := math.Cos(lat0 * math.Pi / 180)
+	points := make([]point, len(rs))
+	for i, r := range rs {
+		points[i] = newPoint(r, lat0, lon0, scale)
+	}
+
+	// each report is compared to the estimate of the others, so an outlier cannot pull the estimate towards itself
+	rejected := 0
+	for len(points) > 2 {
+		worst, worstScore := -1, 1.0
+		for i, p := range points {
+			x, y, sigma := weightedMean(slices.Delete(slices.Clone(points), i, i+1))
+			score := math.Hypot(p.x-x, p.y-y) / (config.OutlierFactor * math.Hypot(p.sigma, sigma))
+			if score > worstScore {
+				worst, worstScore = i, score
+			}
+		}
+		if worst < 0 {
+			break
+		}
+		points = slices.Delete(points, worst, worst+1)
+		rejected++
+	}
+	x, y, sigma := weightedMean(points)
+
+	// spread is the weighted root mean square distance of the reports from the estimate
+	var spread, total float64
+	for _, p := range points {
+		w := 1 / (p.sigma * p.sigma)
+		spread += w * ((p.x-x)*(p.x-x) + (p.y-y)*(p.y-y))
+		total += w
+	}
+	spread = math.Sqrt(spread / total)
+
+	return Estimate{
+		Latitude:  lat0 + y/earthRadius*180/math.Pi,
+		Longitude: lon0 + x/(earthRadius*scale)*180/math.Pi,
+		Radius:    max(sigma, spread),
+		Reports:   len(points),
+		Rejected:  rejected,
+		From:      points[0].report.Data.Timestamp,
+		To:        points[len(points)-1].report.Data.Timestamp,
+		Latest:    points[len(points)-1].report,
+	}
+}
+
+// weightedMean returns the mean of the points weighted by the inverse variance of their accuracy,
+// and the accuracy of the mean.
+func weightedMean(points []point) (x, y, sigma float64) {
+	var total float64
+	for _, p := range points {
+		w := 1 / (p.sigma * p.sigma)
+		x += w * p.x
+		y += w * p.y
+		total += w
+	}
+	return x / total, y / total, 1 / math.Sqrt(total)
+}
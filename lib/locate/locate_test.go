@@ -0,0 +1,136 @@
+package locate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+var start = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func report(minutes int, lat, lon float64, accuracy, confidence uint8) reports.Report {
+	return reports.Report{Data: reports.PayloadData{
+		Timestamp:         start.Add(time.Duration(minutes) * time.Minute),
+		Latitude:          lat,
+		Longitude:         lon,
+		AccuracyMeters:    accuracy,
+		ConfidencePercent: confidence,
+	}}
+}
+
+// distance returns the approximate distance in meters between two close points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dy := (lat2 - lat1) * math.Pi / 180 * earthRadius
+	dx := (lon2 - lon1) * math.Pi / 180 * earthRadius * math.Cos(lat1*math.Pi/180)
+	return math.Hypot(dx, dy)
+}
+
+func TestBest(t *testing.T) {
+	// about 100 m east and west of 45.815, 15.982, accurate reports in the middle
+	// and an outlier 2 km away
+	rs := []reports.Report{
+		report(0, 45.900, 15.900, 10, 100), // an hour before the others, outside the window
+		report(60, 45.815, 15.98071, 50, 100),
+		report(62, 45.815, 15.98329, 50, 100),
+		report(65, 45.815, 15.982, 10, 100),
+		report(67, 45.833, 15.982, 10, 100),
+		report(70, 45.815, 15.982, 20, 100),
+		report(75, 45.815, 15.982, 60, 20), // ignored for low confidence
+	}
+
+	e, ok := Best(rs, Config{MinConfidence: 50})
+	if !ok {
+		t.Fatal("expected an estimate")
+	}
+	if d := distance(e.Latitude, e.Longitude, 45.815, 15.982); d > 5 {
+		t.Errorf("expected the estimate within 5 m of the center, got %.1f m away", d)
+	}
+	if e.Reports != 4 || e.Rejected != 1 {
+		t.Errorf("expected 4 reports and 1 rejected, got %d and %d", e.Reports, e.Rejected)
+	}
+	// the combined accuracy is about 8.7 m, the weighted spread about 25 m
+	if e.Radius < 20 || e.Radius > 35 {
+		t.Errorf("unexpected radius %.1f", e.Radius)
+	}
+	if !e.From.Equal(start.Add(60*time.Minute)) || !e.To.Equal(start.Add(70*time.Minute)) || !e.Latest.Data.Timestamp.Equal(e.To) {
+		t.Errorf("unexpected time range %v - %v", e.From, e.To)
+	}
+
+	if _, ok := Best(rs[6:], Config{MinConfidence: 50}); ok {
+		t.Error("expected no estimate without usable reports")
+	}
+}
+
+func TestBestMoved(t *testing.T) {
+	// the device was at one place and is reported 1 km away by the two newest reports within the window
+	rs := []reports.Report{
+		report(0, 45.815, 15.982, 10, 100),
+		report(5, 45.815, 15.982, 10, 100),
+		report(10, 45.815, 15.982, 10, 100),
+		report(20, 45.824, 15.982, 10, 100),
+		report(25, 45.82410, 15.982, 10, 100),
+	}
+	e, _ := Best(rs, Config{})
+	if d := distance(e.Latitude, e.Longitude, 45.82405, 15.982); d > 1 || e.Reports != 2 || e.Rejected != 3 {
+		t.Errorf("expected the estimate from both reports at the new location, got %+v %.1f m away", e, d)
+	}
+	if !e.From.Equal(start.Add(20*time.Minute)) || !e.To.Equal(start.Add(25*time.Minute)) {
+		t.Errorf("expected the newest reports to be used, got %v - %v", e.From, e.To)
+	}
+}
+
+func TestBestNewestOutlier(t *testing.T) {
+	// only the newest report is 1 km away, it is rejected like any other outlier
+	rs := []reports.Report{
+		report(0, 45.815, 15.982, 10, 100),
+		report(5, 45.815, 15.982, 10, 100),
+		report(10, 45.815, 15.982, 10, 100),
+		report(20, 45.824, 15.982, 10, 100),
+	}
+	e, _ := Best(rs, Config{})
+	if d := distance(e.Latitude, e.Longitude, 45.815, 15.982); d > 1 || e.Reports != 3 || e.Rejected != 1 {
+		t.Errorf("expected the estimate at the old location, got %+v %.1f m away", e, d)
+	}
+	if !e.To.Equal(start.Add(10 * time.Minute)) {
+		t.Errorf("expected the newest report to be rejected, got %v", e.To)
+	}
+}
+
+func TestBestSingle(t *testing.T) {
+	e, ok := Best([]reports.Report{report(0, 45.815, 15.982, 2, 100)}, Config{})
+	if !ok || e.Latitude != 45.815 || e.Longitude != 15.982 || e.Radius != MinAccuracy || e.Reports != 1 {
+		t.Errorf("unexpected estimate %+v", e)
+	}
+}
+
+func TestTwoDisagreeing(t *testing.T) {
+	// of two reports in a cluster neither can be rejected, the uncertainty covers both
+	clusters := Clusters([]reports.Report{
+		report(0, 45.815, 15.982, 10, 100),
+		report(5, 45.824, 15.982, 10, 100),
+	}, Config{})
+	if len(clusters) != 1 || clusters[0].Rejected != 0 || clusters[0].Radius < 400 {
+		t.Errorf("expected both reports used with a large radius, got %+v", clusters)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	rs := []reports.Report{
+		report(50, 45.815, 15.982, 20, 100),
+		report(0, 45.800, 15.960, 20, 100),
+		report(10, 45.800, 15.960, 20, 100),
+		report(45, 45.815, 15.982, 20, 100),
+	}
+	clusters := Clusters(rs, Config{Window: 30 * time.Minute})
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[0].Reports != 2 || clusters[0].Latitude != 45.800 || clusters[1].Reports != 2 || clusters[1].Latitude != 45.815 {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+	if clusters[0].Radius != 20/math.Sqrt2 {
+		t.Errorf("expected the combined accuracy of two agreeing reports, got %f", clusters[0].Radius)
+	}
+}
@@ -0,0 +1,289 @@
+// Package fakebroker implements a local stand-in for an MQTT broker.
+// It accepts MQTT 3.1.1 connections and records the published messages
+// so publishers can be exercised offline.
+package fakebroker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+)
+
+// Conn describes an accepted connection.
+type Conn struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive uint16
+	Will      *mqtt.Message
+}
+
+// Broker is an MQTT broker listening on a local port.
+type Broker struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    []Conn
+	open     map[net.Conn]struct{}
+	messages []mqtt.Message
+	retained map[string]mqtt.Message
+
+	// Username and Password, if set, are required to connect.
+	Username string
+	Password string
+	// IgnorePings stops the broker from answering pings, like a broker behind a dead connection.
+	IgnorePings bool
+}
+
+// New starts a broker on a random local port.
+func New() (*Broker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{
+		ln:       ln,
+		open:     make(map[net.Conn]struct{}),
+		retained: make(map[string]mqtt.Message),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+// Addr returns the host:port the broker listens on.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close stops the broker and closes all connections.
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.mu.Lock()
+	for conn := range b.open {
+		conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return err
+}
+
+// Conns returns the accepted connections.
+func (b *Broker) Conns() []Conn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.conns)
+}
+
+// Messages returns the published messages, including last wills published for lost connections.
+func (b *Broker) Messages() []mqtt.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.messages)
+}
+
+// Retained returns the retained message of the topic.
+func (b *Broker) Retained(topic string) (mqtt.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.retained[topic]
+	return m, ok
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.open[conn] = struct{}{}
+		b.mu.Unlock()
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.serve(conn)
+			b.mu.Lock()
+			delete(b.open, conn)
+			b.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (b *Broker) publish(m mqtt.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, m)
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != 1 {
+		return
+	}
+	c, err := parseConnect(body)
+	if err != nil {
+		return
+	}
+	var code byte
+	if b.Username != "" && (c.Username != b.Username || c.Password != b.Password) {
+		code = 4 // bad user name or password
+	}
+	if err := writePacket(conn, 2<<4, []byte{0, code}); err != nil || code != 0 {
+		return
+	}
+	b.mu.Lock()
+	b.conns = append(b.conns, c)
+	b.mu.Unlock()
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			if c.Will != nil {
+				b.publish(*c.Will)
+			}
+			return
+		}
+		switch header >> 4 {
+		case 3: // PUBLISH
+			qos := header >> 1 & 0x03
+			topic, rest, err := readString(body)
+			if err != nil {
+				return
+			}
+			var id []byte
+			if qos > 0 {
+				if len(rest) < 2 {
+					return
+				}
+				id, rest = rest[:2], rest[2:]
+			}
+			// recorded before the acknowledgement, so it is visible once Publish returns
+			b.publish(mqtt.Message{Topic: topic, Payload: rest, QoS: qos, Retain: header&0x01 != 0})
+			if id != nil {
+				if err := writePacket(conn, 4<<4, id); err != nil {
+					return
+				}
+			}
+		case 12: // PINGREQ
+			if b.IgnorePings {
+				continue
+			}
+			if err := writePacket(conn, 13<<4, nil); err != nil {
+				return
+			}
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func parseConnect(body []byte) (Conn, error) {
+	var c Conn
+	protocol, rest, err := readString(body)
+	if err != nil || protocol != "MQTT" || len(rest) < 4 {
+		return c, errors.New("malformed CONNECT")
+	}
+	flags := rest[1]
+	c.KeepAlive = binary.BigEndian.Uint16(rest[2:])
+	rest = rest[4:]
+	if c.ClientID, rest, err = readString(rest); err != nil {
+		return c, err
+	}
+	if flags&0x04 != 0 {
+		will := &mqtt.Message{QoS: flags >> 3 & 0x03, Retain: flags&0x20 != 0}
+		var payload string
+		if will.Topic, rest, err = readString(rest); err != nil {
+			return c, err
+		}
+		if payload, rest, err = readString(rest); err != nil {
+			return c, err
+		}
+		will.Payload = []byte(payload)
+		c.Will = will
+	}
+	if flags&0x80 != 0 {
+		if c.Username, rest, err = readString(rest); err != nil {
+			return c, err
+		}
+	}
+	if flags&0x40 != 0 {
+		if c.Password, _, err = readString(rest); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("malformed string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
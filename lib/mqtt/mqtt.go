@@ -0,0 +1,424 @@
+// Package mqtt implements a minimal MQTT 3.1.1 client for publishing messages.
+//
+// It supports QoS 0 and 1, retained messages, a last will and keep-alive pings,
+// which is all that is needed to publish device state to a broker such as Mosquitto.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is the default interval of keep-alive pings.
+	DefaultKeepAlive = time.Minute
+	// DefaultConnectTimeout is the timeout of the connection handshake if the context has no deadline.
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// Packet types, shifted into the high nibble of the fixed header.
+const (
+	typeConnect    = 1 << 4
+	typeConnack    = 2 << 4
+	typePublish    = 3 << 4
+	typePuback     = 4 << 4
+	typePingreq    = 12 << 4
+	typePingresp   = 13 << 4
+	typeDisconnect = 14 << 4
+)
+
+var (
+	// ErrClosed is returned when publishing on a closed connection.
+	ErrClosed = errors.New("mqtt: connection closed")
+	// ErrTimeout is the error of connections on which the broker did not answer a keep-alive ping in time.
+	ErrTimeout = errors.New("mqtt: no response to keep-alive ping")
+)
+
+// Message is a message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// QoS is the quality of service, 0 (at most once) or 1 (at least once).
+	QoS    byte
+	Retain bool
+}
+
+// Options configures a connection.
+type Options struct {
+	// ClientID identifies the client to the broker, it is assigned by the broker if empty.
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the interval of keep-alive pings and the time the broker has to answer them
+	// and to accept writes, DefaultKeepAlive if zero.
+	KeepAlive time.Duration
+	// Will is published by the broker when the connection is lost.
+	Will *Message
+	// TLSConfig is used for mqtts:// brokers.
+	TLSConfig *tls.Config
+}
+
+// Client is a connection to a broker.
+type Client struct {
+	conn net.Conn
+	// keepAlive is the interval of pings and the timeout of writes and ping responses.
+	keepAlive time.Duration
+
+	mu     sync.Mutex
+	nextID uint16
+	acks   map[uint16]chan struct{}
+	err    error
+	// pinging is set while a ping is not answered yet.
+	pinging bool
+
+	done chan struct{}
+}
+
+// Dial connects to the broker at addr, given as host:port or as a tcp://, mqtt:// or mqtts:// URL.
+// The port defaults to 1883, or 8883 for mqtts.
+func Dial(ctx context.Context, addr string, opts Options) (*Client, error) {
+	network, host, useTLS, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Will != nil && opts.Will.QoS > 1 {
+		return nil, fmt.Errorf("mqtt: unsupported QoS %d", opts.Will.QoS)
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+
+	var conn net.Conn
+	if useTLS {
+		config := opts.TLSConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		dialer := &tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, network, host)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, network, host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: failed to connect to %s: %w", addr, err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultConnectTimeout)
+	}
+	conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+	if err := connect(conn, r, opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		acks:      make(map[uint16]chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go c.read(r)
+	go c.ping()
+	return c, nil
+}
+
+func parseAddr(addr string) (network, host string, useTLS bool, err error) {
+	port := "1883"
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "tcp", "mqtt":
+		case "ssl", "tls", "mqtts":
+			useTLS, port = true, "8883"
+		default:
+			return "", "", false, fmt.Errorf("mqtt: unsupported scheme %s", u.Scheme)
+		}
+		addr = u.Host
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, port)
+	}
+	return "tcp", addr, useTLS, nil
+}
+
+func connect(conn net.Conn, r *bufio.Reader, opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Will != nil {
+		flags |= 0x04 | opts.Will.QoS<<3
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+
+	var header []byte
+	header = appendString(header, "MQTT")
+	header = append(header, 4, flags) // protocol level 3.1.1
+	header = binary.BigEndian.AppendUint16(header, uint16(opts.KeepAlive/time.Second))
+	if err := writePacket(conn, typeConnect, append(header, payload...)); err != nil {
+		return fmt.Errorf("mqtt: failed to connect: %w", err)
+	}
+
+	typ, body, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("mqtt: failed to connect: %w", err)
+	}
+	if typ&0xf0 != typeConnack || len(body) != 2 {
+		return fmt.Errorf("mqtt: unexpected packet %#x instead of CONNACK", typ)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("mqtt: connection refused: %s", connackReason(body[1]))
+	}
+	return nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("code %d", code)
+	}
+}
+
+// Publish publishes the message. Messages with QoS 1 wait for the acknowledgement of the broker.
+func (c *Client) Publish(ctx context.Context, m Message) error {
+	if m.QoS > 1 {
+		return fmt.Errorf("mqtt: unsupported QoS %d", m.QoS)
+	}
+	flags := typePublish | m.QoS<<1
+	if m.Retain {
+		flags |= 0x01
+	}
+	body := appendString(nil, m.Topic)
+
+	var ack chan struct{}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	var id uint16
+	if m.QoS > 0 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID++
+		}
+		id = c.nextID
+		ack = make(chan struct{})
+		c.acks[id] = ack
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	err := c.write(byte(flags), append(body, m.Payload...))
+	c.mu.Unlock()
+	if err != nil {
+		c.fail(err)
+		return fmt.Errorf("mqtt: failed to publish to %s: %w", m.Topic, err)
+	}
+	if ack == nil {
+		return nil
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.acks, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Done is closed when the connection is closed or lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection was closed, nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects from the broker. The last will is not published.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	err := c.write(typeDisconnect, nil)
+	c.mu.Unlock()
+	c.fail(ErrClosed)
+	return err
+}
+
+// write writes a packet, failing if the broker does not accept it within the keep-alive interval,
+// so a write to a half-open connection does not block forever. It must be called with mu held.
+func (c *Client) write(header byte, body []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	return writePacket(c.conn, header, body)
+}
+
+// fail closes the connection with the error, if it is not closed yet.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
+
+func (c *Client) read(r *bufio.Reader) {
+	for {
+		typ, body, err := readPacket(r)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+				err = ErrClosed
+			}
+			c.fail(err)
+			return
+		}
+		switch typ & 0xf0 {
+		case typePuback:
+			if len(body) < 2 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			if ack, ok := c.acks[id]; ok {
+				close(ack)
+				delete(c.acks, id)
+			}
+			c.mu.Unlock()
+		case typePingresp:
+			c.mu.Lock()
+			c.pinging = false
+			c.mu.Unlock()
+		default:
+			// nothing is subscribed, other packets are ignored
+		}
+	}
+}
+
+// ping sends a ping every keep-alive interval and fails the connection if the previous ping was not
+// answered by then, so a half-open connection is detected even if nothing is published.
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.pinging {
+				c.mu.Unlock()
+				c.fail(ErrTimeout)
+				return
+			}
+			c.pinging = true
+			err := c.write(typePingreq, nil)
+			c.mu.Unlock()
+			if err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// writePacket writes a packet with the fixed header byte and the rest of the packet.
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// readPacket reads a packet and returns the fixed header byte and the rest of the packet.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
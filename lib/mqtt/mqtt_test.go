@@ -0,0 +1,122 @@
+package mqtt_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt/fakebroker"
+)
+
+func newBroker(t *testing.T) *fakebroker.Broker {
+	t.Helper()
+	b, err := fakebroker.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// waitMessages waits until the broker received n messages.
+func waitMessages(t *testing.T, b *fakebroker.Broker, n int) []mqtt.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgs := b.Messages()
+		if len(msgs) >= n || time.Now().After(deadline) {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	b := newBroker(t)
+	b.Username, b.Password = "haystack", "secret"
+	ctx := context.Background()
+
+	c, err := mqtt.Dial(ctx, "mqtt://"+b.Addr(), mqtt.Options{
+		ClientID: "test",
+		Username: "haystack",
+		Password: "secret",
+		Will:     &mqtt.Message{Topic: "haystack/status", Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Publish(ctx, mqtt.Message{Topic: "haystack/status", Payload: []byte("online"), QoS: 1, Retain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(ctx, mqtt.Message{Topic: "haystack/bag", Payload: []byte(`{"latitude":45.8}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := waitMessages(t, b, 2)
+	if len(msgs) != 2 || msgs[0].Topic != "haystack/status" || msgs[1].Topic != "haystack/bag" || msgs[1].QoS != 0 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if m, ok := b.Retained("haystack/status"); !ok || string(m.Payload) != "online" {
+		t.Errorf("expected retained status, got %+v", m)
+	}
+	conns := b.Conns()
+	if len(conns) != 1 || conns[0].ClientID != "test" || conns[0].Will == nil || string(conns[0].Will.Payload) != "offline" {
+		t.Errorf("unexpected connections %+v", conns)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-c.Done()
+	if err := c.Publish(ctx, mqtt.Message{Topic: "haystack/bag"}); err != mqtt.ErrClosed {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	b := newBroker(t)
+	b.Username, b.Password = "haystack", "secret"
+
+	_, err := mqtt.Dial(context.Background(), b.Addr(), mqtt.Options{Username: "haystack", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "bad user name or password") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	b := newBroker(t)
+	c, err := mqtt.Dial(context.Background(), b.Addr(), mqtt.Options{KeepAlive: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case <-c.Done():
+		t.Fatalf("connection with answered pings closed: %v", c.Err())
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	b := newBroker(t)
+	b.IgnorePings = true
+	c, err := mqtt.Dial(context.Background(), b.Addr(), mqtt.Options{KeepAlive: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection without ping responses not closed")
+	}
+	if err := c.Err(); err != mqtt.ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
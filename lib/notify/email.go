@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// NewEmail returns a notifier sending messages by email through the SMTP server at addr (host:port).
+// The server is authenticated to with PLAIN authentication if username is set, which requires
+// the server to support STARTTLS unless it is on localhost.
+func NewEmail(addr, username, password, from string, to []string) Notifier {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		var msg bytes.Buffer
+		fmt.Fprintf(&msg, "From: %s\r\n", from)
+		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+		fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.title()))
+		fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+		msg.WriteString("MIME-Version: 1.0\r\n")
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(strings.ReplaceAll(emailBody(m), "\n", "\r\n"))
+		msg.WriteString("\r\n")
+
+		// net/smtp has no context support, the send is abandoned instead of interrupted
+		errc := make(chan error, 1)
+		go func() {
+			errc <- smtp.SendMail(addr, auth, from, to, msg.Bytes())
+		}()
+		select {
+		case err := <-errc:
+			if err != nil {
+				return fmt.Errorf("email failed: %w", err)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func emailBody(m Message) string {
+	body := m.Text
+	if m.Location != nil {
+		body += fmt.Sprintf("\n\nhttps://www.openstreetmap.org/?mlat=%f&mlon=%f#map=17/%f/%f",
+			m.Location.Latitude, m.Location.Longitude, m.Location.Latitude, m.Location.Longitude)
+	}
+	return body
+}
@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt"
+)
+
+// NewMQTT returns a notifier publishing messages as JSON to the topic of an MQTT broker,
+// see mqtt.Dial for the broker address. Each message is published on a new connection,
+// so notifications are not lost to a connection that broke while idle.
+func NewMQTT(broker, topic, username, password string) Notifier {
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		c, err := mqtt.Dial(ctx, broker, mqtt.Options{Username: username, Password: password})
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		if err := c.Publish(ctx, mqtt.Message{Topic: topic, Payload: payload, QoS: 1}); err != nil {
+			return fmt.Errorf("mqtt notification failed: %w", err)
+		}
+		return nil
+	})
+}
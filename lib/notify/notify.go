@@ -0,0 +1,167 @@
+// Package notify sends notifications about devices, such as a device that moved, has a low battery
+// or has not been seen for a while, through configurable channels: Telegram, webhooks, email,
+// ntfy and Gotify push services and MQTT.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is the timeout of requests sent by the notifiers.
+const DefaultTimeout = 30 * time.Second
+
+// Kinds of notifications sent by the daemons, any other kind may be used as well.
+const (
+	Report     = "report"
+	Moved      = "moved"
+	LowBattery = "low-battery"
+	NotSeen    = "not-seen"
+)
+
+// Location is the location a notification refers to.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Accuracy is the accuracy of the location in meters, 0 if unknown.
+	Accuracy float64 `json:"accuracy,omitempty"`
+}
+
+// Message is a notification about a device.
+type Message struct {
+	Kind     string    `json:"kind,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	DeviceID string    `json:"deviceId,omitempty"`
+	Title    string    `json:"title,omitempty"`
+	Text     string    `json:"text"`
+	Time     time.Time `json:"time"`
+	Location *Location `json:"location,omitempty"`
+}
+
+// String returns the title and text of the message.
+func (m Message) String() string {
+	if m.Title == "" {
+		return m.Text
+	}
+	return m.Title + ": " + m.Text
+}
+
+// title returns the title of the message, or a title made of the device and kind.
+func (m Message) title() string {
+	switch {
+	case m.Title != "":
+		return m.Title
+	case m.Device != "" && m.Kind != "":
+		return m.Device + " " + m.Kind
+	case m.Device != "":
+		return m.Device
+	default:
+		return "haystack"
+	}
+}
+
+// Notifier delivers messages.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, m Message) error
+
+func (f NotifierFunc) Notify(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+// Config configures a notifier. Type selects the implementation, the other fields depend on it:
+//
+//	{"type": "telegram", "token": "123:ABC", "chatId": 1799333354}
+//	{"type": "webhook", "url": "https://example.com/hook", "headers": {"Authorization": "Bearer xyz"}}
+//	{"type": "email", "url": "smtp.example.com:587", "username": "me", "password": "...", "from": "haystack@example.com", "to": ["me@example.com"]}
+//	{"type": "ntfy", "url": "https://ntfy.sh", "topic": "my-haystack", "token": "tk_..."}
+//	{"type": "gotify", "url": "https://gotify.example.com", "token": "A1b2..."}
+//	{"type": "mqtt", "url": "mqtt://localhost:1883", "topic": "haystack/notifications"}
+type Config struct {
+	Type string `json:"type"`
+	// URL is the webhook URL, the host:port of the SMTP server, the ntfy or Gotify server,
+	// the MQTT broker or the Telegram Bot API server (defaults to DefaultTelegramURL).
+	URL string `json:"url,omitempty"`
+	// Token is the Telegram bot token, the ntfy access token or the Gotify application token.
+	Token  string `json:"token,omitempty"`
+	ChatID int64  `json:"chatId,omitempty"`
+	// Topic is the ntfy topic or the MQTT topic.
+	Topic    string   `json:"topic,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	// Headers are added to webhook requests.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Priority is the ntfy (1-5) or Gotify (0-10) priority, the server default if zero.
+	Priority int `json:"priority,omitempty"`
+}
+
+// New creates a notifier of the configured type: telegram, webhook, email, ntfy, gotify or mqtt.
+func New(config Config) (Notifier, error) {
+	switch config.Type {
+	case "telegram":
+		if config.Token == "" || config.ChatID == 0 {
+			return nil, fmt.Errorf("telegram notifier without token or chat")
+		}
+		return NewTelegram(config.URL, config.Token, config.ChatID), nil
+	case "webhook":
+		if config.URL == "" {
+			return nil, fmt.Errorf("webhook notifier without url")
+		}
+		return NewWebhook(config.URL, config.Headers), nil
+	case "email":
+		if config.URL == "" || config.From == "" || len(config.To) == 0 {
+			return nil, fmt.Errorf("email notifier without url, from or to")
+		}
+		return NewEmail(config.URL, config.Username, config.Password, config.From, config.To), nil
+	case "ntfy":
+		if config.URL == "" || config.Topic == "" {
+			return nil, fmt.Errorf("ntfy notifier without url or topic")
+		}
+		return NewNtfy(config.URL, config.Topic, config.Token, config.Priority), nil
+	case "gotify":
+		if config.URL == "" || config.Token == "" {
+			return nil, fmt.Errorf("gotify notifier without url or token")
+		}
+		return NewGotify(config.URL, config.Token, config.Priority), nil
+	case "mqtt":
+		if config.URL == "" || config.Topic == "" {
+			return nil, fmt.Errorf("mqtt notifier without url or topic")
+		}
+		return NewMQTT(config.URL, config.Topic, config.Username, config.Password), nil
+	default:
+		return nil, fmt.Errorf("unsupported notifier type: %q", config.Type)
+	}
+}
+
+var httpClient = &http.Client{Timeout: DefaultTimeout}
+
+// post sends the body to the URL and fails unless the response status is 2xx.
+func post(ctx context.Context, url, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/mqtt/fakebroker"
+)
+
+var message = Message{
+	Kind:     LowBattery,
+	Device:   "bag",
+	DeviceID: "ID1",
+	Text:     "bag battery is low",
+	Time:     time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	Location: &Location{Latitude: 45.815, Longitude: 15.982, Accuracy: 20},
+}
+
+// request is a request received by a test server.
+type request struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// newServer starts an HTTP server recording the requests.
+func newServer(t *testing.T, status int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.Path, header: r.Header, body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	ts, requests := newServer(t, http.StatusOK)
+	n, err := New(Config{Type: "telegram", URL: ts.URL, Token: "123:ABC", ChatID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := requests()
+	if len(rs) != 2 || rs[0].path != "/bot123:ABC/sendMessage" || rs[1].path != "/bot123:ABC/sendLocation" {
+		t.Fatalf("unexpected requests %+v", rs)
+	}
+	var params struct {
+		ChatID int64  `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(rs[0].body), &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.ChatID != 42 || params.Text != message.Text {
+		t.Errorf("unexpected message %+v", params)
+	}
+
+	ts, _ = newServer(t, http.StatusForbidden)
+	n = NewTelegram(ts.URL, "123:ABC", 42)
+	err = n.Notify(context.Background(), message)
+	if err == nil || !strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "123:ABC") {
+		t.Errorf("expected error without token, got %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ts, requests := newServer(t, http.StatusNoContent)
+	n, err := New(Config{Type: "webhook", URL: ts.URL + "/hook", Headers: map[string]string{"Authorization": "Bearer xyz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := requests()
+	if len(rs) != 1 || rs[0].path != "/hook" || rs[0].header.Get("Authorization") != "Bearer xyz" {
+		t.Fatalf("unexpected requests %+v", rs)
+	}
+	var got Message
+	if err := json.Unmarshal([]byte(rs[0].body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != message.Kind || got.Device != "bag" || !got.Time.Equal(message.Time) || got.Location == nil || *got.Location != *message.Location {
+		t.Errorf("unexpected message %+v", got)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	ts, requests := newServer(t, http.StatusOK)
+	n, err := New(Config{Type: "ntfy", URL: ts.URL, Topic: "my-haystack", Token: "tk_1", Priority: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := requests()
+	if len(rs) != 1 || rs[0].path != "/my-haystack" || rs[0].body != message.Text {
+		t.Fatalf("unexpected requests %+v", rs)
+	}
+	h := rs[0].header
+	if h.Get("Title") != "bag low-battery" || h.Get("Priority") != "4" || h.Get("Authorization") != "Bearer tk_1" || h.Get("Tags") != LowBattery {
+		t.Errorf("unexpected headers %v", h)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	ts, requests := newServer(t, http.StatusOK)
+	n, err := New(Config{Type: "gotify", URL: ts.URL + "/", Token: "A1b2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := requests()
+	if len(rs) != 1 || rs[0].path != "/message" || rs[0].header.Get("X-Gotify-Key") != "A1b2" {
+		t.Fatalf("unexpected requests %+v", rs)
+	}
+	if !strings.Contains(rs[0].body, `"message":"bag battery is low"`) || strings.Contains(rs[0].body, "priority") {
+		t.Errorf("unexpected body %s", rs[0].body)
+	}
+}
+
+// smtpServer is a local stand-in for an SMTP server accepting a single message.
+func smtpServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mail := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var transcript strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(cmd, "AUTH"):
+				reply("235 authenticated")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				mail <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), mail
+}
+
+func TestEmail(t *testing.T) {
+	addr, mail := smtpServer(t)
+	n, err := New(Config{Type: "email", URL: addr, Username: "me", Password: "secret", From: "haystack@example.com", To: []string{"me@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := <-mail
+	for _, want := range []string{
+		"AUTH PLAIN",
+		"MAIL FROM:<haystack@example.com>",
+		"RCPT TO:<me@example.com>",
+		"Subject: bag low-battery\r\n",
+		"bag battery is low\r\n\r\nhttps://www.openstreetmap.org/?mlat=45.815000",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("expected %q in %s", want, transcript)
+		}
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	b, err := fakebroker.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	n, err := New(Config{Type: "mqtt", URL: b.Addr(), Topic: "haystack/notifications"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := b.Messages()
+	if len(msgs) != 1 || msgs[0].Topic != "haystack/notifications" || msgs[0].QoS != 1 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	var got Message
+	if err := json.Unmarshal(msgs[0].Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != message.Text {
+		t.Errorf("unexpected message %+v", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, config := range []Config{
+		{Type: "pager"},
+		{Type: "telegram", Token: "123:ABC"},
+		{Type: "email", URL: "localhost:25", From: "haystack@example.com"},
+		{Type: "ntfy", URL: "https://ntfy.sh"},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NewNtfy returns a notifier publishing messages to the topic of an ntfy server, such as https://ntfy.sh.
+// token is the optional access token of the topic, priority the ntfy priority (1-5) or 0 for the default.
+func NewNtfy(server, topic, token string, priority int) Notifier {
+	endpoint := strings.TrimSuffix(server, "/") + "/" + url.PathEscape(topic)
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		header := http.Header{}
+		header.Set("Title", m.title())
+		if m.Kind != "" {
+			header.Set("Tags", m.Kind)
+		}
+		if priority > 0 {
+			header.Set("Priority", strconv.Itoa(priority))
+		}
+		if m.Location != nil {
+			header.Set("Click", fmt.Sprintf("geo:%f,%f", m.Location.Latitude, m.Location.Longitude))
+		}
+		if token != "" {
+			header.Set("Authorization", "Bearer "+token)
+		}
+		if err := post(ctx, endpoint, "text/plain; charset=utf-8", []byte(m.Text), header); err != nil {
+			return fmt.Errorf("ntfy failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// NewGotify returns a notifier sending messages to a Gotify server with an application token.
+// priority is the Gotify priority or 0 for the default of the application.
+func NewGotify(server, token string, priority int) Notifier {
+	endpoint := strings.TrimSuffix(server, "/") + "/message"
+	header := http.Header{}
+	header.Set("X-Gotify-Key", token)
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		params := map[string]any{"title": m.title(), "message": m.Text}
+		if priority > 0 {
+			params["priority"] = priority
+		}
+		body, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		if err := post(ctx, endpoint, "application/json", body, header); err != nil {
+			return fmt.Errorf("gotify failed: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultTelegramURL is the Telegram Bot API server.
+const DefaultTelegramURL = "https://api.telegram.org"
+
+// NewTelegram returns a notifier sending messages to a Telegram chat with the bot token,
+// followed by the location of the message, if any. apiURL defaults to DefaultTelegramURL.
+func NewTelegram(apiURL, token string, chatID int64) Notifier {
+	if apiURL == "" {
+		apiURL = DefaultTelegramURL
+	}
+	endpoint := strings.TrimSuffix(apiURL, "/") + "/bot" + token + "/"
+	send := func(ctx context.Context, method string, params map[string]any) error {
+		params["chat_id"] = chatID
+		body, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		if err := post(ctx, endpoint+method, "application/json", body, nil); err != nil {
+			// the URL contains the bot token, keep it out of the error
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return fmt.Errorf("telegram %s failed: %w", method, err)
+		}
+		return nil
+	}
+
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		if err := send(ctx, "sendMessage", map[string]any{"text": m.String()}); err != nil {
+			return err
+		}
+		if m.Location == nil {
+			return nil
+		}
+		params := map[string]any{"latitude": m.Location.Latitude, "longitude": m.Location.Longitude}
+		if m.Location.Accuracy > 0 {
+			params["horizontal_accuracy"] = min(m.Location.Accuracy, 1500)
+		}
+		return send(ctx, "sendLocation", params)
+	})
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// NewWebhook returns a notifier posting messages as JSON to the URL, with the additional headers.
+func NewWebhook(url string, headers map[string]string) Notifier {
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	return NotifierFunc(func(ctx context.Context, m Message) error {
+		body, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := post(ctx, url, "application/json", body, header); err != nil {
+			return fmt.Errorf("webhook failed: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,270 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+const (
+	// DefaultTimeout is the timeout of the default HTTP client.
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetries is the default number of retries after a transient failure.
+	DefaultRetries = 3
+	// DefaultBackoff is the default delay before the first retry, it doubles with every retry.
+	DefaultBackoff = 500 * time.Millisecond
+)
+
+// Client retrieves and decrypts reports from a macless-haystack server.
+type Client struct {
+	url        string
+	days       int
+	httpClient *http.Client
+	authorize  func(*http.Request)
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithBasicAuth authenticates requests with HTTP basic authentication.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.authorize = func(r *http.Request) {
+			r.SetBasicAuth(username, password)
+		}
+	}
+}
+
+// WithBearerToken authenticates requests with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.authorize = func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// WithRetry sets the number of retries after transient failures and the delay before the first retry.
+// The delay doubles with every retry.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// AuthFromEnv returns the authentication option configured by the HAYSTACK_TOKEN or
+// HAYSTACK_USERNAME and HAYSTACK_PASSWORD environment variables, nil if none are set.
+func AuthFromEnv() Option {
+	if token, ok := os.LookupEnv("HAYSTACK_TOKEN"); ok {
+		return WithBearerToken(token)
+	}
+	if username, ok := os.LookupEnv("HAYSTACK_USERNAME"); ok {
+		return WithBasicAuth(username, os.Getenv("HAYSTACK_PASSWORD"))
+	}
+	return nil
+}
+
+// NewClient creates a client retrieving the reports of the last days from the macless-haystack server at url.
+func NewClient(url string, days int, opts ...Option) *Client {
+	c := &Client{
+		url:        url,
+		days:       days,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c
+}
+
+// GetFn returns a Get function bound to the context.
+func (c *Client) GetFn(ctx context.Context) Get {
+	return func(devices []device.Device) (Reports, error) {
+		return c.Get(ctx, devices)
+	}
+}
+
+// deviceKey is the private key of a single advertisement key and the device it belongs to.
+type deviceKey struct {
+	device     device.Device
+	privateKey []byte
+}
+
+// Result is an encrypted report as returned by the macless-haystack server.
+type Result struct {
+	DatePublished int64  `json:"datePublished"`
+	Payload       string `json:"payload"`
+	Description   string `json:"description"`
+	ID            string `json:"id"`
+	StatusCode    int64  `json:"statusCode"`
+}
+
+// ErrDecrypt wraps the errors of reports that could not be decrypted.
+var ErrDecrypt = errors.New("failed to decrypt payload")
+
+// Get retrieves the reports for the devices, keyed by device ID.
+// Reports that fail to decode or decrypt are skipped and returned as NonFatalError.
+func (c *Client) Get(ctx context.Context, devices []device.Device) (Reports, error) {
+	return c.get(ctx, devices, c.days)
+}
+
+// GetSince is like Get, but only requests as many days as needed to cover the reports published since
+// the given time, up to the days of the client. The server may still return earlier reports of those days.
+func (c *Client) GetSince(ctx context.Context, devices []device.Device, since time.Time) (Reports, error) {
+	days := c.days
+	if !since.IsZero() {
+		days = min(days, max(1, int(math.Ceil(time.Since(since).Hours()/24))))
+	}
+	return c.get(ctx, devices, days)
+}
+
+func (c *Client) get(ctx context.Context, devices []device.Device, days int) (Reports, error) {
+	// rolling keys are queried one by one and their reports are merged back under the device ID
+	now := time.Now()
+	mappedKeys := make(map[string]deviceKey, len(devices))
+	ids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		keys, err := d.KeysBetween(now.AddDate(0, 0, -days), now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys for device %s: %w", d.Name, err)
+		}
+		for _, k := range keys {
+			ids = append(ids, k.ID)
+			mappedKeys[k.ID] = deviceKey{device: d, privateKey: k.PrivateKey}
+		}
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"ids":  ids,
+		"days": days,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	results, err := c.fetch(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs NonFatalError
+	reports := make(Reports)
+	for _, report := range results {
+		// Decode Base64-encoded values
+		rawPayload, err := base64.StdEncoding.DecodeString(report.Payload)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode payload (%s) for device %s: %w", report.Payload, report.ID, err))
+			continue
+		}
+		key, ok := mappedKeys[report.ID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unexpected report for unknown id %s", report.ID))
+			continue
+		}
+		decrypted, err := decrypt(rawPayload, key.privateKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w (%s) for device %s, %s: %w", ErrDecrypt, report.Payload, key.device.Name, report.ID, err))
+			continue
+		}
+
+		reports[key.device.ID] = append(reports[key.device.ID], Report{
+			DatePublished: time.UnixMilli(report.DatePublished).Local(),
+			Description:   report.Description,
+			Data:          parse(rawPayload, decrypted),
+			StatusCode:    report.StatusCode,
+			//RawPayload:    report.Payload,
+		})
+	}
+	if len(errs) > 0 {
+		return reports, errs
+	}
+	return reports, nil
+}
+
+// errTransient marks failures that may succeed when retried.
+var errTransient = errors.New("transient failure")
+
+// fetch posts the request, retrying transient failures with exponential backoff.
+func (c *Client) fetch(ctx context.Context, body []byte) ([]Result, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		results, err := c.post(ctx, body)
+		if err == nil || !errors.Is(err, errTransient) || attempt >= c.retries {
+			return results, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) post(ctx context.Context, body []byte) ([]Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if c.authorize != nil {
+		c.authorize(req)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to make POST request: %w", err)
+		}
+		return nil, fmt.Errorf("%w: failed to make POST request: %w", errTransient, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("unexpected response status %s: %s", resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %w", errTransient, err)
+		}
+		return nil, err
+	}
+
+	response := struct {
+		Results    []Result `json:"results"`
+		StatusCode string   `json:"statusCode"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	if response.StatusCode != "200" {
+		return nil, fmt.Errorf("failed to get reports: %s", response.StatusCode)
+	}
+	return response.Results, nil
+}
@@ -0,0 +1,168 @@
+package reports_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports/fakeserver"
+)
+
+func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server)) (*httptest.Server, *device.Device) {
+	t.Helper()
+	d, err := device.Generate("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeserver.New(*d)
+	if err := srv.AddLocation(d.ID, fakeserver.Location{Data: reports.PayloadData{Timestamp: time.Now(), Latitude: 10, Longitude: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, srv)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, d
+}
+
+func TestClientAuth(t *testing.T) {
+	ts, d := newTestServer(t, func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server) {
+		user, pass, ok := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer secret" && (!ok || user != "user" || pass != "pass") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	})
+
+	tests := []struct {
+		name    string
+		opt     reports.Option
+		wantErr bool
+	}{
+		{"none", nil, true},
+		{"basic", reports.WithBasicAuth("user", "pass"), false},
+		{"wrong basic", reports.WithBasicAuth("user", "wrong"), true},
+		{"bearer", reports.WithBearerToken("secret"), false},
+	}
+	for _, test := range tests {
+		got, err := reports.NewClient(ts.URL, 1, test.opt, reports.WithRetry(0, 0)).Get(context.Background(), []device.Device{*d})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if len(got[d.ID]) != 1 {
+			t.Errorf("%s: expected 1 report, got %d", test.name, len(got[d.ID]))
+		}
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts, d := newTestServer(t, func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	})
+
+	got, err := reports.NewClient(ts.URL, 1, reports.WithRetry(3, time.Millisecond)).Get(context.Background(), []device.Device{*d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 calls, got %d", calls.Load())
+	}
+	if len(got[d.ID]) != 1 {
+		t.Errorf("expected 1 report, got %d", len(got[d.ID]))
+	}
+
+	calls.Store(0)
+	if _, err := reports.NewClient(ts.URL, 1, reports.WithRetry(1, time.Millisecond)).Get(context.Background(), []device.Device{*d}); err == nil {
+		t.Errorf("expected error after exhausting retries")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 calls, got %d", calls.Load())
+	}
+}
+
+func TestClientNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	ts, d := newTestServer(t, func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server) {
+		calls.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+
+	if _, err := reports.NewClient(ts.URL, 1, reports.WithRetry(3, time.Millisecond)).Get(context.Background(), []device.Device{*d}); err == nil {
+		t.Errorf("expected error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	ts, d := newTestServer(t, func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := reports.NewClient(ts.URL, 1, reports.WithRetry(10, time.Second)).Get(ctx, []device.Device{*d})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected retries to stop when the context is done")
+	}
+}
+
+func TestClientGetSince(t *testing.T) {
+	var days atomic.Int32
+	ts, d := newTestServer(t, func(w http.ResponseWriter, r *http.Request, srv *fakeserver.Server) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Days int `json:"days"`
+		}
+		json.Unmarshal(body, &req)
+		days.Store(int32(req.Days))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		srv.ServeHTTP(w, r)
+	})
+
+	c := reports.NewClient(ts.URL, 7, reports.WithRetry(0, 0))
+	for _, test := range []struct {
+		since time.Time
+		want  int32
+	}{
+		{time.Time{}, 7},
+		{time.Now().Add(-time.Hour), 1},
+		{time.Now().Add(-50 * time.Hour), 3},
+		{time.Now().AddDate(0, 0, -30), 7},
+	} {
+		got, err := c.GetSince(context.Background(), []device.Device{*d}, test.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if days.Load() != test.want || len(got[d.ID]) != 1 {
+			t.Errorf("since %v: expected %d days and 1 report, got %d days and %d reports", test.since, test.want, days.Load(), len(got[d.ID]))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package reports
+
+import (
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// Layout is the binary layout of a report payload.
+type Layout int
+
+const (
+	// LayoutLegacy is the 88 byte payload layout used before macOS 14.
+	LayoutLegacy Layout = iota
+	// LayoutMacOS14 is the 89 byte payload layout used since macOS 14.
+	// It has an additional byte after the timestamp.
+	LayoutMacOS14
+)
+
+var ErrInvalidAdvertisementKey = errors.New("invalid advertisement key")
+
+// Encrypt builds a report payload for the location data the way a finder device does: an ephemeral P-224 key
+// is agreed with the advertisement key, a symmetric key is derived with SHA-256 and the location is sealed with AES-GCM.
+// The advertisement key is either the 28 byte advertised key or an uncompressed 57 byte public key.
+// Randomness for the ephemeral key is read from rand, so a deterministic reader produces byte-exact payloads.
+func Encrypt(rand io.Reader, data PayloadData, advertisementKey []byte, layout Layout) ([]byte, error) {
+	curve := elliptic.P224()
+
+	pubX, pubY, err := unmarshalAdvertisementKey(advertisementKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephPriv, err := randomScalar(rand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	ephX, ephY := curve.ScalarBaseMult(ephPriv)
+	ephKey := elliptic.Marshal(curve, ephX, ephY)
+
+	sharedX, _ := curve.ScalarMult(pubX, pubY, ephPriv)
+	aesgcm, iv, err := newCipher(sharedX.FillBytes(make([]byte, 28)), ephKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, 10)
+	binary.BigEndian.PutUint32(plain[0:4], uint32(int32(math.Round(data.Latitude*10000000))))
+	binary.BigEndian.PutUint32(plain[4:8], uint32(int32(math.Round(data.Longitude*10000000))))
+	plain[8] = data.AccuracyMeters
+	plain[9] = data.Status
+
+	payload := make([]byte, 4, 89)
+	binary.BigEndian.PutUint32(payload, uint32(data.Timestamp.Sub(appleEpoch)/time.Second))
+	if layout == LayoutMacOS14 {
+		payload = append(payload, 0x00)
+	}
+	payload = append(payload, data.ConfidencePercent)
+	payload = append(payload, ephKey...)
+	return aesgcm.Seal(payload, iv, plain, nil), nil
+}
+
+// unmarshalAdvertisementKey returns the public key point for an advertisement key.
+// Only the x coordinate is advertised, either of the two matching points gives the same shared key.
+func unmarshalAdvertisementKey(key []byte) (*big.Int, *big.Int, error) {
+	curve := elliptic.P224()
+	params := curve.Params()
+
+	switch len(key) {
+	case 57:
+		x, y := elliptic.Unmarshal(curve, key)
+		if x == nil {
+			return nil, nil, ErrInvalidAdvertisementKey
+		}
+		return x, y, nil
+	case 28:
+		// y² = x³ - 3x + b
+		x := new(big.Int).SetBytes(key)
+		y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+		y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+		y2.Add(y2, params.B).Mod(y2, params.P)
+		y := new(big.Int).ModSqrt(y2, params.P)
+		if y == nil || !curve.IsOnCurve(x, y) {
+			return nil, nil, ErrInvalidAdvertisementKey
+		}
+		return x, y, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unexpected length %d", ErrInvalidAdvertisementKey, len(key))
+	}
+}
+
+// randomScalar returns a random private key for the P-224 curve.
+func randomScalar(rand io.Reader) ([]byte, error) {
+	n := elliptic.P224().Params().N
+	b := make([]byte, 28)
+	for range 100 {
+		if _, err := io.ReadFull(rand, b); err != nil {
+			return nil, err
+		}
+		k := new(big.Int).SetBytes(b)
+		if k.Sign() > 0 && k.Cmp(n) < 0 {
+			return b, nil
+		}
+	}
+	return nil, errors.New("no valid scalar found")
+}
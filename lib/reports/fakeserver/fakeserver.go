@@ -0,0 +1,153 @@
+// Package fakeserver implements a local stand-in for the macless-haystack server.
+// It serves the same JSON API and returns genuinely encrypted reports for a set of devices
+// so the reports client can be exercised offline.
+package fakeserver
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+// Location is a synthetic location report for a device.
+type Location struct {
+	// Published is the time the report was published, defaults to the time in Data.
+	Published time.Time
+	Data      reports.PayloadData
+	Layout    reports.Layout
+}
+
+// Server is a http.Handler serving the macless-haystack reports API.
+type Server struct {
+	mu      sync.Mutex
+	devices map[string]device.Device
+	results map[string][]reports.Result
+
+	// Now returns the current time used to filter reports by age, defaults to time.Now.
+	Now func() time.Time
+	// Rand is the source of the ephemeral keys, defaults to crypto/rand.
+	Rand io.Reader
+}
+
+// New creates a new server serving reports for the given devices.
+func New(devices ...device.Device) *Server {
+	s := &Server{
+		devices: make(map[string]device.Device, len(devices)),
+		results: make(map[string][]reports.Result),
+		Now:     time.Now,
+		Rand:    rand.Reader,
+	}
+	for _, d := range devices {
+		s.AddDevice(d)
+	}
+	return s
+}
+
+// AddDevice adds a device that locations can be reported for.
+func (s *Server) AddDevice(d device.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.ID] = d
+}
+
+// AddLocation encrypts the location with the advertisement key the device used at the time of the location
+// and stores it as a report.
+func (s *Server) AddLocation(deviceID string, loc Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("unknown device %s", deviceID)
+	}
+
+	key, err := d.KeyAt(d.Period(loc.Data.Timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to get key for device %s: %w", d.Name, err)
+	}
+
+	advertisementKey, err := base64.StdEncoding.DecodeString(key.AdvertisementKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode advertisement key: %w", err)
+	}
+
+	payload, err := reports.Encrypt(s.Rand, loc.Data, advertisementKey, loc.Layout)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt location: %w", err)
+	}
+
+	published := loc.Published
+	if published.IsZero() {
+		published = loc.Data.Timestamp
+	}
+
+	s.results[key.ID] = append(s.results[key.ID], reports.Result{
+		DatePublished: published.UnixMilli(),
+		Payload:       base64.StdEncoding.EncodeToString(payload),
+		Description:   "found",
+		ID:            key.ID,
+	})
+	return nil
+}
+
+// AddPayload stores a raw base64 encoded payload for an advertisement key ID, e.g. a corrupt one.
+func (s *Server) AddPayload(id string, published time.Time, payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[id] = append(s.results[id], reports.Result{
+		DatePublished: published.UnixMilli(),
+		Payload:       payload,
+		Description:   "found",
+		ID:            id,
+	})
+}
+
+// ServeHTTP handles the POST request with the advertisement key IDs and number of days to return reports for.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := struct {
+		IDs  []string `json:"ids"`
+		Days int      `json:"days"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	since := s.Now().AddDate(0, 0, -request.Days).UnixMilli()
+	results := []reports.Result{}
+	for _, id := range request.IDs {
+		for _, res := range s.results[id] {
+			if res.DatePublished >= since {
+				results = append(results, res)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(results, func(a, b reports.Result) int {
+		return cmp.Compare(a.DatePublished, b.DatePublished)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"results":    results,
+		"statusCode": "200",
+	})
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
 	"time"
 )
 
@@ -18,8 +17,12 @@ type PayloadData struct {
 	Latitude          float64
 	AccuracyMeters    uint8
 	ConfidencePercent uint8
+	Status            uint8
 }
 
+// appleEpoch is the reference date of report timestamps.
+var appleEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
 func dhExchange(privateKey, publicKey []byte) ([]byte, error) {
 	curve := elliptic.P224() // Matches SECP224R1
 
@@ -28,10 +31,13 @@ func dhExchange(privateKey, publicKey []byte) ([]byte, error) {
 		return nil, errors.New("invalid public key")
 	}
 	sharedX, _ := curve.ScalarMult(x, y, privateKey)
-	return sharedX.Bytes(), nil
+	return sharedX.FillBytes(make([]byte, 28)), nil
 }
 
 func decrypt(payload, key []byte) ([]byte, error) {
+	if len(payload) != 88 && len(payload) != 89 {
+		return nil, fmt.Errorf("invalid payload length %d", len(payload))
+	}
 	encryptedData := payload[4:]
 
 	// Handle potential MacOS 14+ report format
@@ -46,43 +52,56 @@ func decrypt(payload, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to derive shared key: %v", err)
 	}
 
-	// Derive symmetric key
+	aesgcm, iv, err := newCipher(sharedKey, ephKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encData := encryptedData[58:68]
+	tag := encryptedData[68:]
+	decrypted, err := aesgcm.Open(nil, iv, append(encData, tag...), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+
+	return decrypted, nil
+}
+
+// newCipher derives the symmetric key from the shared key and the ephemeral public key
+// and returns the AES-GCM cipher and IV used to seal the report.
+func newCipher(sharedKey, ephKey []byte) (cipher.AEAD, []byte, error) {
 	hash := sha256.New()
 	hash.Write(sharedKey)
 	hash.Write([]byte{0x00, 0x00, 0x00, 0x01})
 	hash.Write(ephKey)
 	symmetricKey := hash.Sum(nil)
 
-	decryptionKey := symmetricKey[:16]
-	iv := symmetricKey[16:]
-	encData := encryptedData[58:68]
-	tag := encryptedData[68:]
-
-	block, err := aes.NewCipher(decryptionKey)
+	block, err := aes.NewCipher(symmetricKey[:16])
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, fmt.Errorf("NewCipher: %w", err)
 	}
 
+	iv := symmetricKey[16:]
 	aesgcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
 	if err != nil {
-		log.Fatal("NewGCMWithNonceSize", err)
-	}
-
-	decrypted, err := aesgcm.Open(nil, iv, append(encData, tag...), nil)
-	if err != nil {
-		return nil, fmt.Errorf("Open: %w", err)
+		return nil, nil, fmt.Errorf("NewGCMWithNonceSize: %w", err)
 	}
-
-	return decrypted, nil
+	return aesgcm, iv, nil
 }
 
 func parse(raw, decrypted []byte) PayloadData {
 	seenTimeStamp := binary.BigEndian.Uint32(raw[:4])
+	confidence := raw[4]
+	// MacOS 14+ reports have an additional byte before the confidence
+	if len(raw) == 89 {
+		confidence = raw[5]
+	}
 	return PayloadData{
-		Timestamp:         time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(seenTimeStamp) * time.Second).Local(),
-		Longitude:         float64(binary.BigEndian.Uint32(decrypted[4:8])) / 10000000,
-		Latitude:          float64(binary.BigEndian.Uint32(decrypted[:4])) / 10000000,
+		Timestamp:         appleEpoch.Add(time.Duration(seenTimeStamp) * time.Second).Local(),
+		Longitude:         float64(int32(binary.BigEndian.Uint32(decrypted[4:8]))) / 10000000,
+		Latitude:          float64(int32(binary.BigEndian.Uint32(decrypted[:4]))) / 10000000,
 		AccuracyMeters:    decrypted[8],
-		ConfidencePercent: raw[4],
+		ConfidencePercent: confidence,
+		Status:            decrypted[9],
 	}
 }
@@ -0,0 +1,116 @@
+package reports
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	mrand "math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	d, err := device.Generate("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	advKey, err := base64.StdEncoding.DecodeString(d.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mrand.New(mrand.NewPCG(1, 2))
+	for i := 0; i < 200; i++ {
+		want := PayloadData{
+			Timestamp:         appleEpoch.Add(time.Duration(r.Uint32()) * time.Second).Local(),
+			Latitude:          float64(r.Int32N(1800000001)-900000000) / 10000000,
+			Longitude:         float64(r.Int64N(3600000001)-1800000000) / 10000000,
+			AccuracyMeters:    uint8(r.UintN(256)),
+			ConfidencePercent: uint8(r.UintN(256)),
+			Status:            uint8(r.UintN(256)),
+		}
+		layout := Layout(i % 2)
+
+		payload, err := Encrypt(rand.Reader, want, advKey, layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantLen := 88 + int(layout); len(payload) != wantLen {
+			t.Fatalf("expected payload length %d, got %d", wantLen, len(payload))
+		}
+
+		decrypted, err := decrypt(payload, d.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := parse(payload, decrypted)
+		if !got.Timestamp.Equal(want.Timestamp) || got.Latitude != want.Latitude || got.Longitude != want.Longitude ||
+			got.AccuracyMeters != want.AccuracyMeters || got.ConfidencePercent != want.ConfidencePercent || got.Status != want.Status {
+			t.Fatalf("round trip mismatch for layout %d:\nwant %+v\ngot  %+v", layout, want, got)
+		}
+	}
+}
+
+func TestEncryptDeterministic(t *testing.T) {
+	d, err := device.Generate("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	advKey, err := base64.StdEncoding.DecodeString(d.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := PayloadData{
+		Timestamp:         time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC),
+		Latitude:          -33.8688,
+		Longitude:         151.2093,
+		AccuracyMeters:    12,
+		ConfidencePercent: 2,
+		Status:            0x10,
+	}
+
+	first, err := Encrypt(mrand.NewChaCha8([32]byte{1}), data, advKey, LayoutMacOS14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Encrypt(mrand.NewChaCha8([32]byte{1}), data, advKey, LayoutMacOS14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected identical payloads for the same randomness")
+	}
+
+	if ts := binary.BigEndian.Uint32(first[:4]); ts != uint32(data.Timestamp.Sub(appleEpoch)/time.Second) {
+		t.Errorf("unexpected timestamp %d", ts)
+	}
+	if first[4] != 0 || first[5] != data.ConfidencePercent {
+		t.Errorf("unexpected header bytes %x", first[4:6])
+	}
+	if first[6] != 0x04 {
+		t.Errorf("expected uncompressed ephemeral key, got prefix 0x%02x", first[6])
+	}
+}
+
+func TestEncryptInvalidKey(t *testing.T) {
+	data := PayloadData{Timestamp: time.Now()}
+	if _, err := Encrypt(rand.Reader, data, make([]byte, 20), LayoutLegacy); err == nil {
+		t.Errorf("expected error for short key")
+	}
+
+	// find an x coordinate that is not on the curve
+	key := make([]byte, 28)
+	for i := byte(1); ; i++ {
+		key[27] = i
+		if _, _, err := unmarshalAdvertisementKey(key); err != nil {
+			break
+		}
+	}
+	if _, err := Encrypt(rand.Reader, data, key, LayoutLegacy); err == nil {
+		t.Errorf("expected error for key that is not on the curve")
+	}
+}
@@ -0,0 +1,110 @@
+package reports_test
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports/fakeserver"
+)
+
+func TestGetFn(t *testing.T) {
+	static, err := device.Generate("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, err := device.GenerateDerived("derived", time.Now().Add(-48*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := fakeserver.New(*static, *derived)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	now := time.Now().Truncate(time.Second)
+	locations := map[string][]fakeserver.Location{
+		static.ID: {
+			{Data: reports.PayloadData{Timestamp: now.Add(-time.Hour), Latitude: 45.815, Longitude: 15.9819, AccuracyMeters: 10, ConfidencePercent: 2}},
+			{Data: reports.PayloadData{Timestamp: now.Add(-30 * time.Minute), Latitude: 45.8151, Longitude: 15.982, AccuracyMeters: 20, ConfidencePercent: 3}, Layout: reports.LayoutMacOS14},
+			// too old to be returned
+			{Data: reports.PayloadData{Timestamp: now.AddDate(0, 0, -10), Latitude: 1, Longitude: 1}},
+		},
+		derived.ID: {
+			{Data: reports.PayloadData{Timestamp: now.Add(-25 * time.Hour), Latitude: 52.52, Longitude: 13.405, AccuracyMeters: 5, ConfidencePercent: 1}},
+			{Data: reports.PayloadData{Timestamp: now.Add(-2 * time.Hour), Latitude: 52.53, Longitude: 13.41, AccuracyMeters: 50, ConfidencePercent: 1}, Layout: reports.LayoutMacOS14},
+			{Data: reports.PayloadData{Timestamp: now.Add(-10 * time.Minute), Latitude: 52.54, Longitude: 13.42, AccuracyMeters: 255, ConfidencePercent: 1}},
+		},
+	}
+	for id, locs := range locations {
+		for _, loc := range locs {
+			if err := srv.AddLocation(id, loc); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got, err := reports.GetFn(ts.URL, 7)([]device.Device{*static, *derived})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected reports for 2 devices, got %d", len(got))
+	}
+
+	for id, locs := range locations {
+		if id == static.ID {
+			locs = locs[:2]
+		}
+		if len(got[id]) != len(locs) {
+			t.Fatalf("expected %d reports for %s, got %d", len(locs), id, len(got[id]))
+		}
+		for i, report := range got[id] {
+			want := locs[i].Data
+			data := report.Data
+			if !data.Timestamp.Equal(want.Timestamp) {
+				t.Errorf("expected timestamp %s, got %s", want.Timestamp, data.Timestamp)
+			}
+			if math.Abs(data.Latitude-want.Latitude) > 1e-6 || math.Abs(data.Longitude-want.Longitude) > 1e-6 {
+				t.Errorf("expected location %f,%f, got %f,%f", want.Latitude, want.Longitude, data.Latitude, data.Longitude)
+			}
+			if data.AccuracyMeters != want.AccuracyMeters || data.ConfidencePercent != want.ConfidencePercent {
+				t.Errorf("expected accuracy %d and confidence %d, got %d and %d", want.AccuracyMeters, want.ConfidencePercent, data.AccuracyMeters, data.ConfidencePercent)
+			}
+		}
+	}
+}
+
+func TestGetFnNonFatalErrors(t *testing.T) {
+	d, err := device.Generate("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := fakeserver.New(*d)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	now := time.Now()
+	if err := srv.AddLocation(d.ID, fakeserver.Location{Data: reports.PayloadData{Timestamp: now, Latitude: 10, Longitude: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	srv.AddPayload(d.ID, now, "not base64")
+	srv.AddPayload(d.ID, now, "AAAA")
+
+	got, err := reports.GetFn(ts.URL, 1)([]device.Device{*d})
+	e := reports.NonFatalError{}
+	if !errors.As(err, &e) {
+		t.Fatalf("expected NonFatalError, got %v", err)
+	}
+	if len(e) != 2 {
+		t.Errorf("expected 2 errors, got %d: %v", len(e), e)
+	}
+	if len(got[d.ID]) != 1 {
+		t.Errorf("expected 1 report, got %d", len(got[d.ID]))
+	}
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package scanner
+
+import "tinygo.org/x/bluetooth"
+
+// unknownMAC is a MAC address we use on macOS because there is no way to obtain the actual MAC address of a device.
+// see https://developer.radiusnetworks.com/2013/10/21/corebluetooth-doesnt-let-you-see-ibeacons.html
+var unknownMAC = bluetooth.MAC{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+func addressMAC(bluetooth.Address) bluetooth.MAC {
+	return unknownMAC
+}
@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package scanner
+
+import "tinygo.org/x/bluetooth"
+
+func addressMAC(address bluetooth.Address) bluetooth.MAC {
+	return address.MAC
+}
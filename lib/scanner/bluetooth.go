@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"slices"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// bluetoothAdapter is an Adapter using the TinyGo bluetooth package.
+type bluetoothAdapter struct {
+	adapter *bluetooth.Adapter
+}
+
+// Bluetooth returns an Adapter scanning with the bluetooth adapter, e.g. bluetooth.DefaultAdapter.
+func Bluetooth(adapter *bluetooth.Adapter) Adapter {
+	return &bluetoothAdapter{adapter: adapter}
+}
+
+func (a *bluetoothAdapter) Enable() error {
+	return a.adapter.Enable()
+}
+
+func (a *bluetoothAdapter) Scan(callback func(Advertisement)) error {
+	return a.adapter.Scan(func(_ *bluetooth.Adapter, result bluetooth.ScanResult) {
+		// the advertisement data is only valid during the callback
+		md := result.ManufacturerData()
+		data := make([]bluetooth.ManufacturerDataElement, 0, len(md))
+		for _, element := range md {
+			data = append(data, bluetooth.ManufacturerDataElement{
+				CompanyID: element.CompanyID,
+				Data:      slices.Clone(element.Data),
+			})
+		}
+
+		callback(Advertisement{
+			Time:             time.Now(),
+			Address:          result.Address.String(),
+			MAC:              addressMAC(result.Address),
+			RSSI:             result.RSSI,
+			LocalName:        result.LocalName(),
+			ManufacturerData: data,
+		})
+	})
+}
+
+func (a *bluetoothAdapter) StopScan() error {
+	return a.adapter.StopScan()
+}
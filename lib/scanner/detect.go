@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+// DetectorConfig configures the unwanted tracker detection.
+//
+// A FindMy device that is separated from its owner keeps the same key for up to a day, so an unknown key
+// that is seen in many distinct time windows over a long enough period, with a signal strong enough
+// to be close by, is likely travelling with the scanner.
+type DetectorConfig struct {
+	// Window is the length of the time windows sightings are counted in.
+	Window time.Duration
+	// MinWindows is the number of distinct windows a key must be seen in before it is flagged.
+	MinWindows int
+	// MinDuration is the minimum time between the first and the last sighting of a flagged key.
+	MinDuration time.Duration
+	// MinRSSI is the minimum average signal strength of a flagged key.
+	MinRSSI int16
+	// Forget is the time after which a key that was not seen anymore is forgotten.
+	Forget time.Duration
+	// Realert is the time after which a flagged key that is still following is reported again, 0 reports it only once.
+	Realert time.Duration
+}
+
+// DefaultDetectorConfig is modelled after the unwanted tracking alerts of iOS and AirGuard:
+// a tracker following for at least 30 minutes, seen in at least 3 separate 5 minute windows.
+var DefaultDetectorConfig = DetectorConfig{
+	Window:      5 * time.Minute,
+	MinWindows:  3,
+	MinDuration: 30 * time.Minute,
+	MinRSSI:     -85,
+	Forget:      time.Hour,
+	Realert:     time.Hour,
+}
+
+// Candidate is an unknown FindMy device seen by the detector.
+type Candidate struct {
+	Key       []byte
+	Address   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Sightings is the number of received advertisements.
+	Sightings int
+	// Windows is the number of distinct time windows the device was seen in.
+	Windows int
+	// MinRSSI, MaxRSSI and MeanRSSI summarize the signal strength of the sightings.
+	MinRSSI  int16
+	MaxRSSI  int16
+	MeanRSSI int16
+	// Status is the last status byte, see findmy.BatteryStatus.
+	Status byte
+}
+
+// Following returns the time the candidate has been following the scanner.
+func (c Candidate) Following() time.Duration {
+	return c.LastSeen.Sub(c.FirstSeen)
+}
+
+// KeyHex returns the hex encoded advertisement key.
+func (c Candidate) KeyHex() string {
+	return hex.EncodeToString(c.Key)
+}
+
+// Battery returns the last battery status of the candidate.
+func (c Candidate) Battery() string {
+	return findmy.BatteryStatus(c.Status)
+}
+
+type sighting struct {
+	candidate Candidate
+	rssiSum   int64
+	window    time.Time
+	alerted   time.Time
+}
+
+// Detector tracks unknown FindMy devices over time and flags the ones that persistently follow the scanner.
+type Detector struct {
+	config DetectorConfig
+	known  *Known
+
+	mu   sync.Mutex
+	seen map[keyID]*sighting
+}
+
+// NewDetector creates a detector. Devices matched by known, which may be nil, are never flagged.
+func NewDetector(config DetectorConfig, known *Known) *Detector {
+	return &Detector{
+		config: config,
+		known:  known,
+		seen:   make(map[keyID]*sighting),
+	}
+}
+
+// Observe records a FindMy event and returns the candidate if it should be alerted now.
+func (d *Detector) Observe(e Event) (Candidate, bool) {
+	if e.Type != EventFindMy || e.Device != nil {
+		return Candidate{}, false
+	}
+	id, ok := newKeyID(e.Key)
+	if !ok {
+		return Candidate{}, false
+	}
+	t := e.Advertisement.Time
+	if d.known != nil {
+		if _, ok := d.known.Match(e.Key, t); ok {
+			return Candidate{}, false
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.forget(t)
+
+	s, ok := d.seen[id]
+	if !ok {
+		s = &sighting{candidate: Candidate{
+			Key:       e.Key,
+			FirstSeen: t,
+			MinRSSI:   e.Advertisement.RSSI,
+			MaxRSSI:   e.Advertisement.RSSI,
+		}}
+		d.seen[id] = s
+	}
+
+	c := &s.candidate
+	c.Address = e.Advertisement.Address
+	c.Status = e.Status
+	if t.After(c.LastSeen) {
+		c.LastSeen = t
+	}
+	c.Sightings++
+	c.MinRSSI = min(c.MinRSSI, e.Advertisement.RSSI)
+	c.MaxRSSI = max(c.MaxRSSI, e.Advertisement.RSSI)
+	s.rssiSum += int64(e.Advertisement.RSSI)
+	c.MeanRSSI = int16(s.rssiSum / int64(c.Sightings))
+	if window := t.Truncate(d.config.Window); window.After(s.window) {
+		s.window = window
+		c.Windows++
+	}
+
+	if !d.following(c) {
+		return Candidate{}, false
+	}
+	if !s.alerted.IsZero() && (d.config.Realert == 0 || t.Sub(s.alerted) < d.config.Realert) {
+		return Candidate{}, false
+	}
+	s.alerted = t
+	return *c, true
+}
+
+// following reports whether the candidate matches the detection criteria.
+func (d *Detector) following(c *Candidate) bool {
+	return c.Windows >= d.config.MinWindows &&
+		c.Following() >= d.config.MinDuration &&
+		c.MeanRSSI >= d.config.MinRSSI
+}
+
+// forget removes the devices that were not seen for the forget time before t.
+func (d *Detector) forget(t time.Time) {
+	if d.config.Forget == 0 {
+		return
+	}
+	for id, s := range d.seen {
+		if t.Sub(s.candidate.LastSeen) > d.config.Forget {
+			delete(d.seen, id)
+		}
+	}
+}
+
+// Candidates returns the currently tracked devices, the ones following the scanner first.
+func (d *Detector) Candidates() []Candidate {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	candidates := make([]Candidate, 0, len(d.seen))
+	for _, s := range d.seen {
+		candidates = append(candidates, s.candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		fi, fj := d.following(&candidates[i]), d.following(&candidates[j])
+		if fi != fj {
+			return fi
+		}
+		return candidates[i].Following() > candidates[j].Following()
+	})
+	return candidates
+}
+
+// Handler records the events and calls alert for every candidate that is following the scanner.
+func (d *Detector) Handler(alert func(Candidate)) Handler {
+	return func(e Event) {
+		if c, ok := d.Observe(e); ok {
+			alert(c)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+)
+
+func TestDetector(t *testing.T) {
+	d, err := device.Generate("own")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownKey, err := base64.StdEncoding.DecodeString(d.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := NewKnown([]device.Device{*d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKey := append([]byte{}, testKey...)
+	weakKey[27] ^= 0xff
+	passingKey := append([]byte{}, testKey...)
+	passingKey[20] ^= 0xff
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var script []Advertisement
+	// the follower, our own device and a weak device are seen every 10 minutes for an hour
+	for i := 0; i <= 6; i++ {
+		for _, adv := range []Advertisement{
+			FindMyAdvertisement(testKey, findmy.StatusBatteryMedium, -60),
+			FindMyAdvertisement(ownKey, findmy.StatusBatteryFull, -50),
+			FindMyAdvertisement(weakKey, findmy.StatusBatteryFull, -95),
+		} {
+			adv.Time = start.Add(time.Duration(i) * 10 * time.Minute)
+			script = append(script, adv)
+		}
+	}
+	// a strong device passing by only once
+	passing := FindMyAdvertisement(passingKey, findmy.StatusBatteryFull, -40)
+	passing.Time = start.Add(time.Minute)
+	script = append(script, passing)
+
+	adapter := NewFakeAdapter(script...)
+	adapter.Enable()
+
+	detector := NewDetector(DefaultDetectorConfig, known)
+	var alerts []Candidate
+	if err := New(adapter).Scan(detector.Handler(func(c Candidate) { alerts = append(alerts, c) })); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d: %+v", len(alerts), alerts)
+	}
+	alert := alerts[0]
+	if !bytes.Equal(alert.Key, testKey) {
+		t.Errorf("expected alert for the follower, got key %s", alert.KeyHex())
+	}
+	if alert.Following() != 30*time.Minute || alert.Windows != 4 || alert.MeanRSSI != -60 {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if alert.Battery() != "medium" {
+		t.Errorf("expected battery medium, got %s", alert.Battery())
+	}
+
+	candidates := detector.Candidates()
+	if len(candidates) != 3 {
+		t.Fatalf("expected 3 candidates, got %d", len(candidates))
+	}
+	if candidates[0].KeyHex() != alert.KeyHex() || candidates[0].Sightings != 7 {
+		t.Errorf("expected follower first, got %+v", candidates[0])
+	}
+}
+
+func TestDetectorRealert(t *testing.T) {
+	config := DefaultDetectorConfig
+	config.Realert = 30 * time.Minute
+	detector := NewDetector(config, nil)
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var alerts []time.Time
+	handler := detector.Handler(func(c Candidate) { alerts = append(alerts, c.LastSeen) })
+	for i := 0; i <= 12; i++ {
+		adv := FindMyAdvertisement(testKey, findmy.StatusBatteryFull, -60)
+		adv.Time = start.Add(time.Duration(i) * 10 * time.Minute)
+		event, _ := Decode(adv)
+		handler(event)
+	}
+	if len(alerts) != 4 {
+		t.Fatalf("expected 4 alerts, got %v", alerts)
+	}
+	if !alerts[1].Equal(start.Add(time.Hour)) {
+		t.Errorf("expected second alert after realert time, got %v", alerts[1])
+	}
+
+	// a device gone for longer than the forget time starts over
+	adv := FindMyAdvertisement(testKey, findmy.StatusBatteryFull, -60)
+	adv.Time = start.Add(5 * time.Hour)
+	event, _ := Decode(adv)
+	if _, ok := detector.Observe(event); ok {
+		t.Errorf("expected no alert after the device was forgotten")
+	}
+	if c := detector.Candidates(); len(c) != 1 || c[0].Sightings != 1 {
+		t.Errorf("expected forgotten device to start over, got %+v", c)
+	}
+}
@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"tinygo.org/x/bluetooth"
+)
+
+var ErrNotEnabled = errors.New("scanner: adapter not enabled")
+
+// ScriptedAdvertisement is an advertisement replayed by FakeAdapter.
+type ScriptedAdvertisement struct {
+	// Delay is the time to wait before the advertisement is received.
+	Delay         time.Duration
+	Advertisement Advertisement
+}
+
+// FakeAdapter is an in-memory Adapter replaying scripted advertisements, so scanning logic can be tested
+// without Bluetooth hardware. Scan returns when the script is finished or StopScan is called.
+type FakeAdapter struct {
+	Script []ScriptedAdvertisement
+
+	mu      sync.Mutex
+	enabled bool
+	stop    chan struct{}
+}
+
+// NewFakeAdapter creates a fake adapter replaying the advertisements without delay.
+func NewFakeAdapter(advertisements ...Advertisement) *FakeAdapter {
+	a := &FakeAdapter{}
+	for _, adv := range advertisements {
+		a.Script = append(a.Script, ScriptedAdvertisement{Advertisement: adv})
+	}
+	return a
+}
+
+func (a *FakeAdapter) Enable() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enabled = true
+	return nil
+}
+
+func (a *FakeAdapter) Scan(callback func(Advertisement)) error {
+	a.mu.Lock()
+	if !a.enabled {
+		a.mu.Unlock()
+		return ErrNotEnabled
+	}
+	stop := make(chan struct{})
+	a.stop = stop
+	a.mu.Unlock()
+
+	for _, scripted := range a.Script {
+		if scripted.Delay > 0 {
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(scripted.Delay):
+			}
+		} else {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+		}
+
+		adv := scripted.Advertisement
+		if adv.Time.IsZero() {
+			adv.Time = time.Now()
+		}
+		callback(adv)
+	}
+	return nil
+}
+
+func (a *FakeAdapter) StopScan() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+	return nil
+}
+
+// FindMyAdvertisement returns the advertisement a FindMy device with the 28 byte advertisement key sends.
+func FindMyAdvertisement(key []byte, status byte, rssi int16) Advertisement {
+	mac := bluetooth.MAC{key[5], key[4], key[3], key[2], key[1], key[0] | 0xC0}
+	data := findmy.NewData(key, status)
+	return Advertisement{
+		Address:          mac.String(),
+		MAC:              mac,
+		RSSI:             rssi,
+		ManufacturerData: []bluetooth.ManufacturerDataElement{data},
+	}
+}
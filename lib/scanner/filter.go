@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+)
+
+// DerivedKeyWindow is how far around the time of an advertisement rolling keys of known devices are matched,
+// to tolerate clock drift between the scanner and the devices.
+const DerivedKeyWindow = 2 * time.Hour
+
+// keyID identifies an advertisement key by its last 22 bytes, which are sent in the payload.
+// The first 6 bytes are sent as the address and are not available on every platform.
+type keyID [22]byte
+
+func newKeyID(key []byte) (keyID, bool) {
+	var id keyID
+	if len(key) != 28 {
+		return id, false
+	}
+	copy(id[:], key[6:])
+	return id, true
+}
+
+// Known matches advertisement keys against known devices, including the rolling keys of derived devices.
+type Known struct {
+	mu      sync.Mutex
+	devices []device.Device
+	static  map[keyID]int
+	derived map[keyID]int
+	// rolling keys are derived for a window and re-derived when an advertisement falls outside of it
+	validFrom time.Time
+	validTo   time.Time
+}
+
+// NewKnown creates a matcher for the advertisement keys of the devices.
+func NewKnown(devices []device.Device) (*Known, error) {
+	k := &Known{
+		devices: devices,
+		static:  make(map[keyID]int, len(devices)),
+	}
+	for i, d := range devices {
+		if d.UsesDerivation() {
+			continue
+		}
+		for _, sk := range d.StaticKeys() {
+			key, err := base64.StdEncoding.DecodeString(sk.AdvertisementKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode advertisement key of device %s: %w", d.Name, err)
+			}
+			id, ok := newKeyID(key)
+			if !ok {
+				return nil, fmt.Errorf("invalid advertisement key length %d for device %s", len(key), d.Name)
+			}
+			k.static[id] = i
+		}
+	}
+	return k, nil
+}
+
+// Devices returns the known devices.
+func (k *Known) Devices() []device.Device {
+	return k.devices
+}
+
+// Match returns the device advertising the key at time t.
+func (k *Known) Match(key []byte, t time.Time) (device.Device, bool) {
+	id, ok := newKeyID(key)
+	if !ok {
+		return device.Device{}, false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if i, ok := k.static[id]; ok {
+		return k.devices[i], true
+	}
+
+	if t.Before(k.validFrom) || !t.Before(k.validTo) {
+		k.deriveKeys(t)
+	}
+	if i, ok := k.derived[id]; ok {
+		return k.devices[i], true
+	}
+	return device.Device{}, false
+}
+
+// deriveKeys derives the rolling keys of all derived devices around time t.
+func (k *Known) deriveKeys(t time.Time) {
+	k.derived = make(map[keyID]int)
+	k.validFrom = t.Add(-DerivedKeyWindow / 2)
+	k.validTo = t.Add(DerivedKeyWindow / 2)
+
+	for i, d := range k.devices {
+		if !d.UsesDerivation() {
+			continue
+		}
+		keys, err := d.KeysBetween(t.Add(-DerivedKeyWindow), t.Add(DerivedKeyWindow))
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			advKey, err := base64.StdEncoding.DecodeString(key.AdvertisementKey)
+			if err != nil {
+				continue
+			}
+			if id, ok := newKeyID(advKey); ok {
+				k.derived[id] = i
+			}
+		}
+	}
+}
+
+// Label sets the device of FindMy events of known devices before passing all events to next.
+func Label(known *Known, next Handler) Handler {
+	return func(e Event) {
+		if e.Type == EventFindMy && e.Device == nil {
+			if d, ok := known.Match(e.Key, e.Advertisement.Time); ok {
+				e.Device = &d
+			}
+		}
+		next(e)
+	}
+}
+
+// FilterRSSI passes only events with a signal strength of at least min to next.
+func FilterRSSI(min int16, next Handler) Handler {
+	return func(e Event) {
+		if e.Advertisement.RSSI >= min {
+			next(e)
+		}
+	}
+}
+
+// FilterKnown passes only FindMy events of known devices to next.
+func FilterKnown(known *Known, next Handler) Handler {
+	return Label(known, func(e Event) {
+		if e.Device != nil {
+			next(e)
+		}
+	})
+}
+
+// Presence tracks when known devices were last seen.
+type Presence struct {
+	mu       sync.Mutex
+	known    *Known
+	started  time.Time
+	lastSeen map[string]time.Time
+}
+
+// NewPresence creates a presence tracker for the known devices, started at the given time.
+func NewPresence(known *Known, started time.Time) *Presence {
+	return &Presence{
+		known:    known,
+		started:  started,
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Handler records the events of known devices before passing all events to next.
+func (p *Presence) Handler(next Handler) Handler {
+	return Label(p.known, func(e Event) {
+		if e.Device != nil {
+			p.mu.Lock()
+			if e.Advertisement.Time.After(p.lastSeen[e.Device.ID]) {
+				p.lastSeen[e.Device.ID] = e.Advertisement.Time
+			}
+			p.mu.Unlock()
+		}
+		next(e)
+	})
+}
+
+// Absence is a known device that has not been seen for a while.
+type Absence struct {
+	Device device.Device
+	// LastSeen is the time the device was last seen, zero if it was never seen.
+	LastSeen time.Time
+}
+
+// NotSeen returns the known devices that were not seen during the timeout before now.
+// Devices are reported only once the scan has run for the timeout.
+func (p *Presence) NotSeen(now time.Time, timeout time.Duration) []Absence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.started) < timeout {
+		return nil
+	}
+
+	var absent []Absence
+	for _, d := range p.known.Devices() {
+		lastSeen := p.lastSeen[d.ID]
+		if now.Sub(lastSeen) >= timeout {
+			absent = append(absent, Absence{Device: d, LastSeen: lastSeen})
+		}
+	}
+	return absent
+}
@@ -0,0 +1,128 @@
+// Package scanner decodes FindMy advertisements received from a BLE adapter into typed events.
+//
+// The Adapter interface decouples the scanning logic from the Bluetooth stack, so it can be
+// used with the TinyGo bluetooth package on any platform and with FakeAdapter in tests.
+package scanner
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"tinygo.org/x/bluetooth"
+)
+
+// Advertisement is a received BLE advertisement.
+type Advertisement struct {
+	// Time the advertisement was received.
+	Time time.Time
+	// Address is the printable address of the advertiser.
+	Address string
+	// MAC is the address of the advertiser. It is unknown (all 0xff) on platforms that hide it, such as macOS.
+	MAC              bluetooth.MAC
+	RSSI             int16
+	LocalName        string
+	ManufacturerData []bluetooth.ManufacturerDataElement
+}
+
+// Adapter is a BLE adapter able to scan for advertisements.
+type Adapter interface {
+	// Enable enables the adapter.
+	Enable() error
+	// Scan calls the callback for each received advertisement until StopScan is called.
+	Scan(callback func(Advertisement)) error
+	// StopScan stops an ongoing scan.
+	StopScan() error
+}
+
+// EventType is the type of a decoded advertisement.
+type EventType int
+
+const (
+	// EventFindMy is an advertisement of a device registered for offline finding.
+	EventFindMy EventType = iota
+	// EventUnregistered is an advertisement of a FindMy device that is not registered yet.
+	EventUnregistered
+	// EventInvalid is an Apple advertisement that could not be parsed as FindMy data.
+	EventInvalid
+)
+
+// Event is a decoded Apple advertisement.
+type Event struct {
+	Type          EventType
+	Advertisement Advertisement
+	// Status is the FindMy status byte, see findmy.BatteryStatus.
+	Status byte
+	// Key is the advertisement key reconstructed from the address and the payload.
+	Key []byte
+	// Data is the raw manufacturer data.
+	Data []byte
+	// Err is the parsing error of EventInvalid events.
+	Err error
+	// Device is the known device that sent the advertisement, see Label.
+	Device *device.Device
+}
+
+// Handler handles decoded events.
+type Handler func(Event)
+
+// Decode decodes an advertisement. It returns false for advertisements without Apple manufacturer data.
+func Decode(adv Advertisement) (Event, bool) {
+	for _, md := range adv.ManufacturerData {
+		if md.CompanyID != findmy.AppleCompanyID {
+			continue
+		}
+
+		event := Event{Advertisement: adv, Data: md.Data}
+		status, key, err := findmy.ParseData(adv.MAC, md.Data)
+		switch {
+		case err == findmy.ErrorUnregistered:
+			event.Type = EventUnregistered
+		case err != nil:
+			event.Type = EventInvalid
+			event.Err = err
+		default:
+			event.Type = EventFindMy
+			event.Status = status
+			event.Key = key
+		}
+		return event, true
+	}
+	return Event{}, false
+}
+
+// KeyHex returns the hex encoded advertisement key.
+func (e Event) KeyHex() string {
+	return hex.EncodeToString(e.Key)
+}
+
+// Scanner scans for advertisements and passes the decoded Apple advertisements to a handler.
+type Scanner struct {
+	adapter Adapter
+
+	// OnAdvertisement, if set, is called with every received advertisement before it is decoded.
+	OnAdvertisement func(Advertisement)
+}
+
+// New creates a scanner using the adapter. The adapter must be enabled before scanning.
+func New(adapter Adapter) *Scanner {
+	return &Scanner{adapter: adapter}
+}
+
+// Scan scans until Stop is called and calls the handler for every decoded Apple advertisement.
+func (s *Scanner) Scan(handler Handler) error {
+	return s.adapter.Scan(func(adv Advertisement) {
+		if s.OnAdvertisement != nil {
+			s.OnAdvertisement(adv)
+		}
+		if event, ok := Decode(adv); ok {
+			handler(event)
+		}
+	})
+}
+
+// Stop stops the scan.
+func (s *Scanner) Stop() error {
+	return s.adapter.StopScan()
+}
@@ -0,0 +1,212 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"tinygo.org/x/bluetooth"
+)
+
+var testKey = []byte{0xce, 0x8b, 0xad, 0x5f, 0x8a, 0x02, 0x71, 0x53, 0x8f, 0xf5, 0xaf, 0xda, 0x87, 0x49, 0x8c, 0xb0, 0x67, 0xe9, 0xa0, 0x20, 0xd6, 0xe4, 0x16, 0x78, 0x01, 0xd5, 0x5d, 0x83}
+
+func TestScan(t *testing.T) {
+	unregistered := Advertisement{
+		Address:          "11:22:33:44:55:66",
+		RSSI:             -70,
+		ManufacturerData: []bluetooth.ManufacturerDataElement{{CompanyID: findmy.AppleCompanyID, Data: []byte{findmy.PayloadUnregistered}}},
+	}
+	invalid := Advertisement{
+		Address:          "11:22:33:44:55:77",
+		ManufacturerData: []bluetooth.ManufacturerDataElement{{CompanyID: findmy.AppleCompanyID, Data: []byte{findmy.PayloadTypeRegistered, 0x01}}},
+	}
+	other := Advertisement{
+		Address:          "11:22:33:44:55:88",
+		ManufacturerData: []bluetooth.ManufacturerDataElement{{CompanyID: 0xffff, Data: []byte{0x01}}},
+	}
+
+	adapter := NewFakeAdapter(FindMyAdvertisement(testKey, findmy.StatusBatteryLow, -50), unregistered, invalid, other)
+	if err := New(adapter).Scan(func(Event) {}); err != ErrNotEnabled {
+		t.Errorf("expected ErrNotEnabled, got %v", err)
+	}
+	if err := adapter.Enable(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	if err := New(adapter).Scan(func(e Event) { events = append(events, e) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	if events[0].Type != EventFindMy {
+		t.Fatalf("expected FindMy event, got %d", events[0].Type)
+	}
+	if !bytes.Equal(events[0].Key, testKey) {
+		t.Errorf("expected key %x, got %s", testKey, events[0].KeyHex())
+	}
+	if events[0].Status != findmy.StatusBatteryLow || events[0].Advertisement.RSSI != -50 {
+		t.Errorf("unexpected status 0x%02x or RSSI %d", events[0].Status, events[0].Advertisement.RSSI)
+	}
+	if events[0].Advertisement.Time.IsZero() {
+		t.Errorf("expected receive time to be set")
+	}
+
+	if events[1].Type != EventUnregistered {
+		t.Errorf("expected unregistered event, got %d", events[1].Type)
+	}
+	if events[2].Type != EventInvalid || events[2].Err != findmy.ErrorDataTooShort {
+		t.Errorf("expected invalid event with ErrorDataTooShort, got %d (%v)", events[2].Type, events[2].Err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	adapter := &FakeAdapter{Script: []ScriptedAdvertisement{
+		{Advertisement: FindMyAdvertisement(testKey, findmy.StatusBatteryFull, -50)},
+		{Delay: time.Hour, Advertisement: FindMyAdvertisement(testKey, findmy.StatusBatteryFull, -50)},
+	}}
+	adapter.Enable()
+	s := New(adapter)
+
+	done := make(chan int)
+	go func() {
+		count := 0
+		s.Scan(func(Event) { count++ })
+		done <- count
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case count := <-done:
+		if count != 1 {
+			t.Errorf("expected 1 event before stopping, got %d", count)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scan did not stop")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	d, err := device.Generate("known")
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownKey, err := base64.StdEncoding.DecodeString(d.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := NewKnown([]device.Device{*d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter := NewFakeAdapter(
+		FindMyAdvertisement(knownKey, findmy.StatusBatteryFull, -40),
+		FindMyAdvertisement(knownKey, findmy.StatusBatteryFull, -90),
+		FindMyAdvertisement(testKey, findmy.StatusBatteryFull, -40),
+	)
+	adapter.Enable()
+
+	var events []Event
+	handler := FilterKnown(known, FilterRSSI(-60, func(e Event) { events = append(events, e) }))
+	if err := New(adapter).Scan(handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if match, ok := known.Match(events[0].Key, events[0].Advertisement.Time); !ok || match.Name != "known" {
+		t.Errorf("expected event of the known device")
+	}
+}
+
+func TestKnownDerived(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+	d, err := device.GenerateDerived("derived", start, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := NewKnown([]device.Device{*d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	current, err := d.KeyAt(d.Period(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(current.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := known.Match(key, now); !ok {
+		t.Errorf("expected current rolling key to match")
+	}
+	// scanner clock ahead of the device clock
+	if _, ok := known.Match(key, now.Add(30*time.Minute)); !ok {
+		t.Errorf("expected rolling key to match with clock drift")
+	}
+	if _, ok := known.Match(key, now.Add(12*time.Hour)); ok {
+		t.Errorf("expected rolling key not to match half a day later")
+	}
+}
+
+func TestPresence(t *testing.T) {
+	seen, err := device.Generate("seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	silent, err := device.Generate("silent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := NewKnown([]device.Device{*seen, *silent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(seen.AdvertisementKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	adv := FindMyAdvertisement(key, findmy.StatusBatteryFull, -50)
+	adv.Time = start.Add(time.Minute)
+	adapter := NewFakeAdapter(adv)
+	adapter.Enable()
+
+	presence := NewPresence(known, start)
+	var labeled []string
+	if err := New(adapter).Scan(presence.Handler(func(e Event) {
+		if e.Device != nil {
+			labeled = append(labeled, e.Device.Name)
+		}
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if len(labeled) != 1 || labeled[0] != "seen" {
+		t.Errorf("expected event labeled with seen, got %v", labeled)
+	}
+
+	if absent := presence.NotSeen(start.Add(4*time.Minute), 5*time.Minute); len(absent) != 0 {
+		t.Errorf("expected no absent devices before the timeout, got %d", len(absent))
+	}
+	absent := presence.NotSeen(start.Add(5*time.Minute), 5*time.Minute)
+	if len(absent) != 1 || absent[0].Device.Name != "silent" || !absent[0].LastSeen.IsZero() {
+		t.Errorf("expected silent device to be never seen, got %+v", absent)
+	}
+	absent = presence.NotSeen(start.Add(6*time.Minute), 5*time.Minute)
+	if len(absent) != 2 || !absent[0].LastSeen.Equal(adv.Time) {
+		t.Errorf("expected both devices absent, got %+v", absent)
+	}
+}
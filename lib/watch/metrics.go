@@ -0,0 +1,186 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+// fetchBuckets are the upper bounds in seconds of the fetch latency histogram.
+var fetchBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metrics are the counters of a Watcher, written in the Prometheus text format.
+type metrics struct {
+	mu      sync.Mutex
+	devices []device.Device
+	// reports counts the new reports of each device.
+	reports map[string]int
+	// located is the location time of the newest report of each device.
+	located map[string]time.Time
+
+	fetches       int
+	fetchErrors   int
+	decryptErrors int
+	// buckets counts the fetches per bucket of fetchBuckets, not cumulative.
+	buckets     []int
+	fetchTime   float64
+	lastSuccess time.Time
+	lastError   error
+}
+
+func newMetrics(devices []device.Device) *metrics {
+	return &metrics{
+		devices: devices,
+		reports: make(map[string]int),
+		located: make(map[string]time.Time),
+		buckets: make([]int, len(fetchBuckets)+1),
+	}
+}
+
+// fetched records a fetch.
+func (m *metrics) fetched(d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetches++
+	m.fetchTime += d.Seconds()
+	i := 0
+	for i < len(fetchBuckets) && d.Seconds() > fetchBuckets[i] {
+		i++
+	}
+	m.buckets[i]++
+
+	var nonFatal reports.NonFatalError
+	switch {
+	case err == nil:
+	case errors.As(err, &nonFatal):
+		for _, e := range nonFatal {
+			if errors.Is(e, reports.ErrDecrypt) {
+				m.decryptErrors++
+			}
+		}
+	default:
+		m.fetchErrors++
+		m.lastError = err
+		return
+	}
+	m.lastSuccess = time.Now()
+	m.lastError = nil
+}
+
+// report records a new report of the device.
+func (m *metrics) report(deviceID string, located time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reports[deviceID]++
+	if located.After(m.located[deviceID]) {
+		m.located[deviceID] = located
+	}
+}
+
+// seen records the location time of a known report of the device.
+func (m *metrics) seen(deviceID string, located time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if located.After(m.located[deviceID]) {
+		m.located[deviceID] = located
+	}
+}
+
+func (m *metrics) write(w io.Writer, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP haystack_reports_total New reports retrieved for the device.")
+	fmt.Fprintln(w, "# TYPE haystack_reports_total counter")
+	for _, d := range m.devices {
+		fmt.Fprintf(w, "haystack_reports_total{device=%s} %d\n", quote(d.Name), m.reports[d.ID])
+	}
+	fmt.Fprintln(w, "# HELP haystack_last_seen_age_seconds Age of the newest reported location of the device.")
+	fmt.Fprintln(w, "# TYPE haystack_last_seen_age_seconds gauge")
+	for _, d := range m.devices {
+		if located, ok := m.located[d.ID]; ok {
+			fmt.Fprintf(w, "haystack_last_seen_age_seconds{device=%s} %g\n", quote(d.Name), now.Sub(located).Seconds())
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP haystack_fetch_duration_seconds Latency of report retrievals.")
+	fmt.Fprintln(w, "# TYPE haystack_fetch_duration_seconds histogram")
+	cumulative := 0
+	for i, le := range fetchBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(w, "haystack_fetch_duration_seconds_bucket{le=\"%g\"} %d\n", le, cumulative)
+	}
+	fmt.Fprintf(w, "haystack_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.fetches)
+	fmt.Fprintf(w, "haystack_fetch_duration_seconds_sum %g\n", m.fetchTime)
+	fmt.Fprintf(w, "haystack_fetch_duration_seconds_count %d\n", m.fetches)
+
+	fmt.Fprintln(w, "# HELP haystack_fetch_errors_total Failed report retrievals.")
+	fmt.Fprintln(w, "# TYPE haystack_fetch_errors_total counter")
+	fmt.Fprintf(w, "haystack_fetch_errors_total %d\n", m.fetchErrors)
+	fmt.Fprintln(w, "# HELP haystack_decrypt_errors_total Reports that could not be decrypted.")
+	fmt.Fprintln(w, "# TYPE haystack_decrypt_errors_total counter")
+	fmt.Fprintf(w, "haystack_decrypt_errors_total %d\n", m.decryptErrors)
+	if !m.lastSuccess.IsZero() {
+		fmt.Fprintln(w, "# HELP haystack_last_success_timestamp_seconds Time of the last successful retrieval.")
+		fmt.Fprintln(w, "# TYPE haystack_last_success_timestamp_seconds gauge")
+		fmt.Fprintf(w, "haystack_last_success_timestamp_seconds %d\n", m.lastSuccess.Unix())
+	}
+}
+
+// quote quotes a label value.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Health is the response of the health check.
+type Health struct {
+	Status      string     `json:"status"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// health reports the watcher as healthy until a poll fails and while the last success is recent.
+func (m *metrics) health(now time.Time, maxAge time.Duration) (Health, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := Health{Status: "ok"}
+	if !m.lastSuccess.IsZero() {
+		lastSuccess := m.lastSuccess
+		h.LastSuccess = &lastSuccess
+	}
+	if m.lastError != nil {
+		h.Error = m.lastError.Error()
+	}
+	if m.lastError != nil && (m.lastSuccess.IsZero() || now.Sub(m.lastSuccess) > maxAge) {
+		h.Status = "failing"
+		return h, false
+	}
+	return h, true
+}
+
+// Handler serves the health check at /healthz, which fails once no poll succeeded for three intervals,
+// and the metrics in the Prometheus text format at /metrics.
+func (w *Watcher) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(rw http.ResponseWriter, r *http.Request) {
+		h, ok := w.metrics.health(time.Now(), 3*w.config.Interval)
+		rw.Header().Set("Content-Type", "application/json")
+		if !ok {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(h)
+	})
+	mux.HandleFunc("GET /metrics", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.metrics.write(rw, time.Now())
+	})
+	return mux
+}
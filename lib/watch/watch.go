@@ -0,0 +1,194 @@
+// Package watch polls the reports of devices and passes on only the reports published since the
+// previous poll, backing off while the server fails. It keeps metrics of the polls, which it serves
+// for Prometheus together with a health check.
+package watch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+const (
+	// DefaultInterval is the default interval between polls.
+	DefaultInterval = 5 * time.Minute
+	// DefaultRetryDelay is the default delay before polling again after a failed poll, it doubles
+	// with every consecutive failure.
+	DefaultRetryDelay = 30 * time.Second
+	// DefaultMaxBackoff is the default limit of the delay after failed polls.
+	DefaultMaxBackoff = time.Hour
+)
+
+// Fetch retrieves the reports of the devices published since the given time, which is zero on the first poll.
+// It may return earlier reports as well. See reports.Client.GetSince.
+type Fetch func(ctx context.Context, devices []device.Device, since time.Time) (reports.Reports, error)
+
+// Batch are the new reports of a device, ordered by publish time.
+type Batch struct {
+	Device  *device.Device
+	Reports []reports.Report
+	// Initial is set for the reports of the first successful poll of the device without a known newest report,
+	// which may include reports published long before the watcher started.
+	Initial bool
+}
+
+// Config configures a Watcher.
+type Config struct {
+	Devices []device.Device
+	Fetch   Fetch
+	// Interval is the interval between polls, DefaultInterval if zero.
+	Interval time.Duration
+	// RetryDelay is the delay after the first failed poll, DefaultRetryDelay if zero.
+	RetryDelay time.Duration
+	// MaxBackoff limits the delay after consecutive failed polls, DefaultMaxBackoff if zero.
+	MaxBackoff time.Duration
+	// OnReports is called with the new reports of each device.
+	OnReports func(ctx context.Context, b Batch)
+	Logger    *slog.Logger
+}
+
+// Watcher polls the reports of devices.
+type Watcher struct {
+	config  Config
+	logger  *slog.Logger
+	metrics *metrics
+
+	mu sync.Mutex
+	// newest is the publish time of the newest report of each device.
+	newest map[string]time.Time
+}
+
+// New creates a watcher.
+func New(config Config) *Watcher {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultRetryDelay
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.OnReports == nil {
+		config.OnReports = func(context.Context, Batch) {}
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	return &Watcher{
+		config:  config,
+		logger:  config.Logger,
+		metrics: newMetrics(config.Devices),
+		newest:  make(map[string]time.Time),
+	}
+}
+
+// SetNewest sets the publish time of the newest report already known for the device,
+// such as the newest report in a history store, so only later reports are passed on.
+func (w *Watcher) SetNewest(deviceID string, published time.Time, located time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if published.After(w.newest[deviceID]) {
+		w.newest[deviceID] = published
+	}
+	w.metrics.seen(deviceID, located)
+}
+
+// since returns the time reports are needed since, the oldest newest report of the devices.
+func (w *Watcher) since() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var since time.Time
+	for i, d := range w.config.Devices {
+		newest, ok := w.newest[d.ID]
+		if !ok {
+			return time.Time{}
+		}
+		if i == 0 || newest.Before(since) {
+			since = newest
+		}
+	}
+	return since
+}
+
+// Poll retrieves the reports once and passes on the new ones. It returns the number of new reports.
+// Reports that could not be decrypted are counted and logged, but do not fail the poll.
+func (w *Watcher) Poll(ctx context.Context) (int, error) {
+	start := time.Now()
+	deviceReports, err := w.config.Fetch(ctx, w.config.Devices, w.since())
+	w.metrics.fetched(time.Since(start), err)
+	if err != nil {
+		var nonFatal reports.NonFatalError
+		if !errors.As(err, &nonFatal) {
+			return 0, err
+		}
+		w.logger.Warn("reports retrieved with errors", "error", err)
+	}
+
+	count := 0
+	for i := range w.config.Devices {
+		d := &w.config.Devices[i]
+		rs := w.newReports(d.ID, deviceReports[d.ID])
+		if len(rs.Reports) == 0 {
+			continue
+		}
+		count += len(rs.Reports)
+		rs.Device = d
+		w.config.OnReports(ctx, rs)
+	}
+	return count, nil
+}
+
+// newReports returns the reports published after the newest known report and records the newest.
+func (w *Watcher) newReports(deviceID string, rs []reports.Report) Batch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	newest, known := w.newest[deviceID]
+	rs = slices.DeleteFunc(slices.Clone(rs), func(r reports.Report) bool {
+		return !r.DatePublished.After(newest)
+	})
+	slices.SortFunc(rs, func(a, b reports.Report) int {
+		return a.DatePublished.Compare(b.DatePublished)
+	})
+	if len(rs) == 0 {
+		return Batch{}
+	}
+	w.newest[deviceID] = rs[len(rs)-1].DatePublished
+	for _, r := range rs {
+		w.metrics.report(deviceID, r.Data.Timestamp)
+	}
+	return Batch{Reports: rs, Initial: !known}
+}
+
+// Run polls until the context is canceled. After a failed poll it polls again after the retry delay,
+// which doubles with every consecutive failure up to the maximum backoff.
+func (w *Watcher) Run(ctx context.Context) {
+	delay := w.config.RetryDelay
+	for {
+		next := w.config.Interval
+		n, err := w.Poll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			next = delay
+			delay = min(delay*2, w.config.MaxBackoff)
+			w.logger.Error("failed to get reports", "error", err, "retry", next.String())
+		} else {
+			delay = w.config.RetryDelay
+			w.logger.Debug("polled reports", "new", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next):
+		}
+	}
+}
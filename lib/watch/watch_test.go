@@ -0,0 +1,198 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports/fakeserver"
+)
+
+func TestPoll(t *testing.T) {
+	d, err := device.Generate("bag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeserver.New(*d)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	now := time.Now().Truncate(time.Second)
+	addLocation := func(age time.Duration) {
+		t.Helper()
+		loc := fakeserver.Location{
+			Published: now.Add(-age),
+			Data:      reports.PayloadData{Timestamp: now.Add(-age - time.Minute), Latitude: 45.8, Longitude: 15.9},
+		}
+		if err := srv.AddLocation(d.ID, loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addLocation(3 * time.Hour)
+	addLocation(2 * time.Hour)
+
+	client := reports.NewClient(ts.URL, 7, reports.WithRetry(0, 0))
+	var batches []Batch
+	w := New(Config{
+		Devices:   []device.Device{*d},
+		Fetch:     client.GetSince,
+		OnReports: func(ctx context.Context, b Batch) { batches = append(batches, b) },
+	})
+
+	ctx := context.Background()
+	if n, err := w.Poll(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 reports, got %d, %v", n, err)
+	}
+	if len(batches) != 1 || !batches[0].Initial || batches[0].Device.Name != "bag" ||
+		!batches[0].Reports[0].DatePublished.Before(batches[0].Reports[1].DatePublished) {
+		t.Fatalf("unexpected batches %+v", batches)
+	}
+
+	batches = nil
+	if n, err := w.Poll(ctx); err != nil || n != 0 || len(batches) != 0 {
+		t.Fatalf("expected no new reports, got %d, %v", n, err)
+	}
+
+	addLocation(time.Hour)
+	if n, err := w.Poll(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 new report, got %d, %v", n, err)
+	}
+	if len(batches) != 1 || batches[0].Initial || !batches[0].Reports[0].DatePublished.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("unexpected batches %+v", batches)
+	}
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`haystack_reports_total{device="bag"} 3`,
+		`haystack_last_seen_age_seconds{device="bag"} 3`,
+		`haystack_fetch_duration_seconds_count 3`,
+		`haystack_fetch_errors_total 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestSetNewest(t *testing.T) {
+	d := device.Device{ID: "ID1", Name: "bag"}
+	now := time.Now()
+	rs := reports.Reports{d.ID: {
+		{DatePublished: now.Add(-2 * time.Hour)},
+		{DatePublished: now.Add(-time.Hour)},
+	}}
+	var since time.Time
+	var got []reports.Report
+	w := New(Config{
+		Devices: []device.Device{d},
+		Fetch: func(ctx context.Context, devices []device.Device, s time.Time) (reports.Reports, error) {
+			since = s
+			return rs, nil
+		},
+		OnReports: func(ctx context.Context, b Batch) {
+			if b.Initial {
+				t.Error("expected no initial batch after SetNewest")
+			}
+			got = b.Reports
+		},
+	})
+	w.SetNewest(d.ID, now.Add(-90*time.Minute), now.Add(-100*time.Minute))
+	if n, err := w.Poll(context.Background()); err != nil || n != 1 || len(got) != 1 {
+		t.Fatalf("expected 1 new report, got %d, %v", n, err)
+	}
+	if !since.Equal(now.Add(-90 * time.Minute)) {
+		t.Errorf("expected reports requested since the newest known report, got %v", since)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	d := device.Device{ID: "ID1", Name: "bag"}
+	w := New(Config{
+		Devices: []device.Device{d},
+		Fetch: func(ctx context.Context, devices []device.Device, since time.Time) (reports.Reports, error) {
+			return reports.Reports{}, reports.NonFatalError{
+				fmt.Errorf("%w for device bag: bad tag", reports.ErrDecrypt),
+				fmt.Errorf("%w for device bag: bad tag", reports.ErrDecrypt),
+				errors.New("unexpected report for unknown id"),
+			}
+		},
+		Logger: discardLogger(),
+	})
+	if _, err := w.Poll(context.Background()); err != nil {
+		t.Fatalf("expected decrypt errors to be non fatal, got %v", err)
+	}
+	w.config.Fetch = func(ctx context.Context, devices []device.Device, since time.Time) (reports.Reports, error) {
+		return nil, errors.New("connection refused")
+	}
+	if _, err := w.Poll(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "haystack_decrypt_errors_total 2\n") || !strings.Contains(body, "haystack_fetch_errors_total 1\n") {
+		t.Errorf("unexpected metrics:\n%s", body)
+	}
+	// the last success is recent, so the failure does not make the watcher unhealthy yet
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "connection refused") {
+		t.Errorf("unexpected health %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRunBackoff(t *testing.T) {
+	var mu sync.Mutex
+	var calls []time.Time
+	ctx, cancel := context.WithCancel(context.Background())
+	w := New(Config{
+		Devices: []device.Device{{ID: "ID1", Name: "bag"}},
+		Fetch: func(context.Context, []device.Device, time.Time) (reports.Reports, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, time.Now())
+			if len(calls) == 5 {
+				cancel()
+			}
+			return nil, errors.New("unavailable")
+		},
+		Interval:   time.Hour,
+		RetryDelay: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+		Logger:     discardLogger(),
+	})
+	w.Run(ctx)
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected failing health, got %d", rec.Code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 5 {
+		t.Fatalf("expected 5 polls, got %d", len(calls))
+	}
+	for i, want := range []time.Duration{10, 20, 40, 40} {
+		if gap := calls[i+1].Sub(calls[i]); gap < want*time.Millisecond {
+			t.Errorf("expected a delay of at least %dms before poll %d, got %v", want, i+2, gap)
+		}
+	}
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,161 @@
+(function () {
+	"use strict";
+
+	const PALETTE = ["#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"];
+	const RELOAD_INTERVAL = 60 * 1000;
+
+	const rangeSelect = document.getElementById("range");
+	const custom = document.getElementById("custom");
+	const fromInput = document.getElementById("from");
+	const toInput = document.getElementById("to");
+	const list = document.getElementById("devices");
+	const status = document.getElementById("status");
+
+	let map;
+	let devices = [];
+	let fitted = false;
+	const hidden = new Set(JSON.parse(localStorage.getItem("haystack.hidden") || "[]"));
+
+	function escapeHTML(s) {
+		return String(s).replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+	}
+
+	async function getJSON(path) {
+		const response = await fetch(path);
+		if (!response.ok) {
+			throw new Error(`${path}: ${response.status} ${await response.text()}`);
+		}
+		return response.json();
+	}
+
+	function formatTime(t) {
+		return new Date(t).toLocaleString();
+	}
+
+	// query returns the query string selecting the visible devices.
+	function query(extra) {
+		const params = new URLSearchParams(extra);
+		for (const d of devices) {
+			if (!hidden.has(d.id)) {
+				params.append("device", d.id);
+			}
+		}
+		return params.toString();
+	}
+
+	// trackRange returns the from and to parameters of the selected time range, null for no tracks.
+	function trackRange() {
+		const range = rangeSelect.value;
+		if (range === "0") {
+			return null;
+		}
+		if (range === "custom") {
+			const params = {};
+			if (fromInput.value) {
+				params.from = new Date(fromInput.value).toISOString();
+			}
+			if (toInput.value) {
+				params.to = new Date(toInput.value).toISOString();
+			}
+			return params;
+		}
+		return {from: new Date(Date.now() - Number(range) * 3600 * 1000).toISOString()};
+	}
+
+	function renderDevices(latest) {
+		const positions = new Map(latest.map((p) => [p.device, p]));
+		list.replaceChildren();
+		for (const d of devices) {
+			const p = positions.get(d.id);
+			const li = document.createElement("li");
+			li.innerHTML = `<input type="checkbox"${hidden.has(d.id) ? "" : " checked"}>` +
+				`<span class="swatch" style="background:${escapeHTML(d.color)}"></span>` +
+				`<span>${escapeHTML(d.name)}</span>` +
+				`<span class="details">${p ? `${escapeHTML(formatTime(p.timestamp))}, battery ${escapeHTML(p.battery)}` : "no reports"}</span>`;
+			li.querySelector("input").addEventListener("change", (e) => {
+				if (e.target.checked) {
+					hidden.delete(d.id);
+				} else {
+					hidden.add(d.id);
+				}
+				localStorage.setItem("haystack.hidden", JSON.stringify([...hidden]));
+				load();
+			});
+			li.addEventListener("click", (e) => {
+				if (p && e.target.tagName !== "INPUT") {
+					map.showPopup(d.id);
+				}
+			});
+			list.appendChild(li);
+		}
+	}
+
+	async function load() {
+		try {
+			const range = trackRange();
+			const selected = devices.some((d) => !hidden.has(d.id));
+			const [latest, tracks, refresh] = await Promise.all([
+				getJSON("api/latest?" + query()),
+				range && selected ? getJSON("api/tracks?" + query(range)) : [],
+				getJSON("api/status"),
+			]);
+			const colors = new Map(devices.map((d) => [d.id, d.color]));
+			const names = new Map(devices.map((d) => [d.id, d.name]));
+
+			// the marker shows the estimated location when there is one, the latest report otherwise
+			const markers = (selected ? latest : []).map((p) => {
+				const e = p.estimate || {latitude: p.latitude, longitude: p.longitude, radius: p.accuracy, reports: 1};
+				return {
+					id: p.device,
+					lat: e.latitude,
+					lon: e.longitude,
+					accuracy: e.radius,
+					color: colors.get(p.device),
+					html: `<strong>${escapeHTML(names.get(p.device))}</strong><br>` +
+						`${escapeHTML(formatTime(p.timestamp))}<br>` +
+						`${e.latitude.toFixed(5)}, ${e.longitude.toFixed(5)} ±${Math.round(e.radius)} m<br>` +
+						(e.reports > 1 ? `estimated from ${e.reports} reports<br>` : "") +
+						`battery ${escapeHTML(p.battery)}, confidence ${p.confidence}%`,
+				};
+			});
+			const lines = tracks.map((t) => ({
+				color: colors.get(t.device),
+				points: t.points.map((p) => ({lat: p.latitude, lon: p.longitude})),
+			}));
+			map.setLayers(lines, markers);
+			if (!fitted && markers.length > 0) {
+				map.fitBounds(markers);
+				fitted = true;
+			}
+			renderDevices(latest);
+
+			status.classList.toggle("error", Boolean(refresh.error));
+			status.textContent = refresh.error ? `Refresh failed: ${refresh.error}` :
+				refresh.lastRefresh ? `Reports retrieved ${formatTime(refresh.lastRefresh)}` : "Retrieving reports…";
+		} catch (e) {
+			status.classList.add("error");
+			status.textContent = e.message;
+		}
+	}
+
+	async function start() {
+		const config = await getJSON("api/config");
+		map = new SlippyMap(document.getElementById("map"), config);
+		devices = (await getJSON("api/devices")).map((d, i) => ({...d, color: d.color || PALETTE[i % PALETTE.length]}));
+
+		rangeSelect.addEventListener("change", () => {
+			custom.hidden = rangeSelect.value !== "custom";
+			load();
+		});
+		fromInput.addEventListener("change", load);
+		toInput.addEventListener("change", load);
+
+		await load();
+		setInterval(load, RELOAD_INTERVAL);
+	}
+
+	start().catch((e) => {
+		status.classList.add("error");
+		status.textContent = e.message;
+	});
+})();
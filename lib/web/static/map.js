@@ -0,0 +1,277 @@
+// A minimal slippy map: raster tiles that can be dragged and zoomed, with tracks and markers drawn in SVG.
+// It is small enough to be embedded, so the UI does not load any scripts from the internet.
+(function () {
+	"use strict";
+
+	const TILE_SIZE = 256;
+	const MIN_ZOOM = 2;
+	const MAX_ZOOM = 19;
+	const SVG = "http://www.w3.org/2000/svg";
+
+	// project returns the position of the coordinate in pixels on the world map at the zoom level.
+	function project(lat, lon, zoom) {
+		const size = TILE_SIZE * Math.pow(2, zoom);
+		const sin = Math.sin(Math.max(-85.05, Math.min(85.05, lat)) * Math.PI / 180);
+		return {
+			x: (lon + 180) / 360 * size,
+			y: (0.5 - Math.log((1 + sin) / (1 - sin)) / (4 * Math.PI)) * size,
+		};
+	}
+
+	// unproject returns the coordinate of the position in pixels on the world map at the zoom level.
+	function unproject(x, y, zoom) {
+		const size = TILE_SIZE * Math.pow(2, zoom);
+		const n = Math.PI - 2 * Math.PI * y / size;
+		return {
+			lat: 180 / Math.PI * Math.atan(Math.sinh(n)),
+			lon: x / size * 360 - 180,
+		};
+	}
+
+	// metersPerPixel returns the size of a pixel at the latitude and zoom level.
+	function metersPerPixel(lat, zoom) {
+		return 156543.03392 * Math.cos(lat * Math.PI / 180) / Math.pow(2, zoom);
+	}
+
+	function svg(name, attributes) {
+		const el = document.createElementNS(SVG, name);
+		for (const [key, value] of Object.entries(attributes)) {
+			el.setAttribute(key, value);
+		}
+		return el;
+	}
+
+	function SlippyMap(container, options) {
+		this.container = container;
+		this.tileURL = options.tileURL;
+		this.center = {lat: 20, lon: 0};
+		this.zoom = MIN_ZOOM;
+		this.tracks = [];
+		this.markers = [];
+		this.popup = null;
+		this.images = new Map();
+
+		this.tileLayer = document.createElement("div");
+		this.tileLayer.className = "tiles";
+		this.overlay = svg("svg", {class: "overlay"});
+		this.popupLayer = document.createElement("div");
+
+		const controls = document.createElement("div");
+		controls.className = "controls";
+		for (const [label, delta] of [["+", 1], ["−", -1]]) {
+			const button = document.createElement("button");
+			button.textContent = label;
+			button.addEventListener("click", () => this.setZoom(this.zoom + delta));
+			controls.appendChild(button);
+		}
+
+		const attribution = document.createElement("div");
+		attribution.className = "attribution";
+		attribution.textContent = options.attribution || "";
+		attribution.hidden = !options.attribution;
+
+		container.append(this.tileLayer, this.overlay, this.popupLayer, controls, attribution);
+		this.listen();
+		new ResizeObserver(() => this.render()).observe(container);
+	}
+
+	SlippyMap.prototype.listen = function () {
+		let drag = null;
+		this.container.addEventListener("pointerdown", (e) => {
+			if (e.button !== 0 || e.target.closest(".marker, .popup, .controls")) {
+				return;
+			}
+			drag = {x: e.clientX, y: e.clientY, center: project(this.center.lat, this.center.lon, this.zoom)};
+			this.container.setPointerCapture(e.pointerId);
+			this.container.classList.add("dragging");
+		});
+		this.container.addEventListener("pointermove", (e) => {
+			if (!drag) {
+				return;
+			}
+			this.center = unproject(drag.center.x - (e.clientX - drag.x), drag.center.y - (e.clientY - drag.y), this.zoom);
+			this.render();
+		});
+		const end = () => {
+			drag = null;
+			this.container.classList.remove("dragging");
+		};
+		this.container.addEventListener("pointerup", end);
+		this.container.addEventListener("pointercancel", end);
+
+		this.container.addEventListener("wheel", (e) => {
+			e.preventDefault();
+			const now = Date.now();
+			if (this.lastWheel && now - this.lastWheel < 250) {
+				return;
+			}
+			this.lastWheel = now;
+			const rect = this.container.getBoundingClientRect();
+			this.setZoom(this.zoom + (e.deltaY < 0 ? 1 : -1), {x: e.clientX - rect.left, y: e.clientY - rect.top});
+		}, {passive: false});
+
+		this.container.addEventListener("dblclick", (e) => {
+			if (e.target.closest(".marker, .popup, .controls")) {
+				return;
+			}
+			const rect = this.container.getBoundingClientRect();
+			this.setZoom(this.zoom + 1, {x: e.clientX - rect.left, y: e.clientY - rect.top});
+		});
+	};
+
+	// setZoom zooms the map, keeping the point at the container position in place.
+	SlippyMap.prototype.setZoom = function (zoom, around) {
+		zoom = Math.max(MIN_ZOOM, Math.min(MAX_ZOOM, zoom));
+		if (zoom === this.zoom) {
+			return;
+		}
+		if (around) {
+			const topLeft = this.topLeft();
+			const fixed = unproject(topLeft.x + around.x, topLeft.y + around.y, this.zoom);
+			const p = project(fixed.lat, fixed.lon, zoom);
+			this.center = unproject(p.x - around.x + this.container.clientWidth / 2, p.y - around.y + this.container.clientHeight / 2, zoom);
+		}
+		this.zoom = zoom;
+		this.render();
+	};
+
+	// topLeft returns the position of the top left corner of the container on the world map.
+	SlippyMap.prototype.topLeft = function () {
+		const c = project(this.center.lat, this.center.lon, this.zoom);
+		return {x: c.x - this.container.clientWidth / 2, y: c.y - this.container.clientHeight / 2};
+	};
+
+	// setLayers replaces the tracks, {color, points} with points as {lat, lon}, and the markers,
+	// {id, lat, lon, accuracy, color, html}.
+	SlippyMap.prototype.setLayers = function (tracks, markers) {
+		this.tracks = tracks;
+		this.markers = markers;
+		if (this.popup && !markers.some((m) => m.id === this.popup.id)) {
+			this.popup = null;
+		}
+		this.render();
+	};
+
+	// fitBounds centers and zooms the map to show all coordinates.
+	SlippyMap.prototype.fitBounds = function (coordinates) {
+		if (coordinates.length === 0) {
+			return;
+		}
+		const padding = 40;
+		const width = Math.max(1, this.container.clientWidth - 2 * padding);
+		const height = Math.max(1, this.container.clientHeight - 2 * padding);
+		let zoom = MAX_ZOOM - 3;
+		for (; zoom > MIN_ZOOM; zoom--) {
+			const points = coordinates.map((c) => project(c.lat, c.lon, zoom));
+			const xs = points.map((p) => p.x);
+			const ys = points.map((p) => p.y);
+			if (Math.max(...xs) - Math.min(...xs) <= width && Math.max(...ys) - Math.min(...ys) <= height) {
+				break;
+			}
+		}
+		const points = coordinates.map((c) => project(c.lat, c.lon, zoom));
+		const xs = points.map((p) => p.x);
+		const ys = points.map((p) => p.y);
+		this.zoom = zoom;
+		this.center = unproject((Math.min(...xs) + Math.max(...xs)) / 2, (Math.min(...ys) + Math.max(...ys)) / 2, zoom);
+		this.render();
+	};
+
+	SlippyMap.prototype.render = function () {
+		this.renderTiles();
+		this.renderOverlay();
+	};
+
+	SlippyMap.prototype.renderTiles = function () {
+		const topLeft = this.topLeft();
+		const count = Math.pow(2, this.zoom);
+		const minX = Math.floor(topLeft.x / TILE_SIZE);
+		const minY = Math.max(0, Math.floor(topLeft.y / TILE_SIZE));
+		const maxX = Math.floor((topLeft.x + this.container.clientWidth) / TILE_SIZE);
+		const maxY = Math.min(count - 1, Math.floor((topLeft.y + this.container.clientHeight) / TILE_SIZE));
+
+		const visible = new Set();
+		for (let y = minY; y <= maxY; y++) {
+			for (let x = minX; x <= maxX; x++) {
+				const key = `${this.zoom}/${x}/${y}`;
+				visible.add(key);
+				let img = this.images.get(key);
+				if (!img) {
+					const wrapped = ((x % count) + count) % count;
+					img = document.createElement("img");
+					img.alt = "";
+					img.draggable = false;
+					img.src = this.tileURL.replace("{z}", this.zoom).replace("{x}", wrapped).replace("{y}", y);
+					this.images.set(key, img);
+					this.tileLayer.appendChild(img);
+				}
+				img.style.left = `${Math.round(x * TILE_SIZE - topLeft.x)}px`;
+				img.style.top = `${Math.round(y * TILE_SIZE - topLeft.y)}px`;
+			}
+		}
+		for (const [key, img] of this.images) {
+			if (!visible.has(key)) {
+				img.remove();
+				this.images.delete(key);
+			}
+		}
+	};
+
+	SlippyMap.prototype.renderOverlay = function () {
+		const topLeft = this.topLeft();
+		const screen = (c) => {
+			const p = project(c.lat, c.lon, this.zoom);
+			return {x: p.x - topLeft.x, y: p.y - topLeft.y};
+		};
+
+		this.overlay.replaceChildren();
+		for (const track of this.tracks) {
+			const points = track.points.map(screen).map((p) => `${p.x.toFixed(1)},${p.y.toFixed(1)}`).join(" ");
+			this.overlay.appendChild(svg("polyline", {
+				points: points, fill: "none", stroke: track.color, "stroke-width": 3, "stroke-opacity": 0.7,
+				"stroke-linejoin": "round", "stroke-linecap": "round",
+			}));
+			for (const p of track.points.map(screen)) {
+				this.overlay.appendChild(svg("circle", {cx: p.x, cy: p.y, r: 2.5, fill: track.color}));
+			}
+		}
+
+		for (const marker of this.markers) {
+			const p = screen(marker);
+			const radius = (marker.accuracy || 0) / metersPerPixel(marker.lat, this.zoom);
+			if (radius > 8) {
+				this.overlay.appendChild(svg("circle", {
+					cx: p.x, cy: p.y, r: radius, fill: marker.color, "fill-opacity": 0.15, stroke: marker.color, "stroke-opacity": 0.5,
+				}));
+			}
+			const circle = svg("circle", {cx: p.x, cy: p.y, r: 8, fill: marker.color, stroke: "#fff", "stroke-width": 2, class: "marker"});
+			circle.addEventListener("click", () => {
+				this.popup = this.popup && this.popup.id === marker.id ? null : marker;
+				this.renderOverlay();
+			});
+			this.overlay.appendChild(circle);
+		}
+
+		this.popupLayer.replaceChildren();
+		if (this.popup) {
+			const p = screen(this.popup);
+			const popup = document.createElement("div");
+			popup.className = "popup";
+			popup.style.left = `${p.x}px`;
+			popup.style.top = `${p.y}px`;
+			popup.innerHTML = this.popup.html;
+			this.popupLayer.appendChild(popup);
+		}
+	};
+
+	// showPopup opens the popup of the marker with the id.
+	SlippyMap.prototype.showPopup = function (id) {
+		this.popup = this.markers.find((m) => m.id === id) || null;
+		if (this.popup) {
+			this.center = {lat: this.popup.lat, lon: this.popup.lon};
+			this.render();
+		}
+	};
+
+	window.SlippyMap = SlippyMap;
+})();
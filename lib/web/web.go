@@ -0,0 +1,323 @@
+// Package web serves a map of the location history of devices and the JSON API it is built on.
+//
+// All assets are embedded, so the UI works without internet access apart from the map tiles.
+package web
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/locate"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+const (
+	// DefaultRefresh is the default interval reports are retrieved at.
+	DefaultRefresh = 15 * time.Minute
+	// DefaultTileURL is the default map tile server, OpenStreetMap.
+	DefaultTileURL = "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+	// DefaultAttribution is the attribution of the default map tiles.
+	DefaultAttribution = "© OpenStreetMap contributors"
+)
+
+//go:embed static
+var static embed.FS
+
+// Config configures a Server.
+type Config struct {
+	// Devices are the devices shown on the map.
+	Devices []device.Device
+	// Get retrieves the reports of the devices.
+	Get reports.Get
+	// Store keeps the reports between runs. Without it only the reports of the last retrieval are shown.
+	Store *history.Store
+	// Refresh is the interval reports are retrieved at by Run, DefaultRefresh if zero.
+	Refresh time.Duration
+	// TileURL is the URL template of the map tiles, DefaultTileURL if empty.
+	TileURL string
+	// Attribution is shown on the map, DefaultAttribution if TileURL is not set.
+	Attribution string
+	// Logger receives refresh errors, slog.Default() if nil.
+	Logger *slog.Logger
+}
+
+// Server serves the map UI and the API.
+type Server struct {
+	config Config
+
+	mu          sync.Mutex
+	reports     reports.Reports
+	lastRefresh time.Time
+	lastErr     error
+}
+
+// New creates a server, reports are retrieved by Refresh or Run.
+func New(config Config) *Server {
+	if config.Refresh <= 0 {
+		config.Refresh = DefaultRefresh
+	}
+	if config.TileURL == "" {
+		config.TileURL = DefaultTileURL
+		config.Attribution = DefaultAttribution
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	return &Server{config: config, reports: make(reports.Reports)}
+}
+
+// Run retrieves reports immediately and then every refresh interval, until the context is done.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Refresh)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(); err != nil {
+			s.config.Logger.Error("failed to refresh reports", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh retrieves the reports of the devices. Reports retrieved with non fatal errors are kept.
+func (s *Server) Refresh() error {
+	r, err := s.config.Get(s.config.Devices)
+	if err != nil && !errors.As(err, &reports.NonFatalError{}) {
+		s.setStatus(err)
+		return err
+	}
+
+	if s.config.Store != nil {
+		if _, storeErr := s.config.Store.Add(r); storeErr != nil {
+			s.setStatus(storeErr)
+			return storeErr
+		}
+	} else {
+		s.mu.Lock()
+		s.reports = r
+		s.mu.Unlock()
+	}
+	s.setStatus(err)
+	return err
+}
+
+func (s *Server) setStatus(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRefresh = time.Now()
+	s.lastErr = err
+}
+
+// query returns the reports matching the query, from the store if there is one.
+func (s *Server) query(q history.Query) reports.Reports {
+	if s.config.Store != nil {
+		return s.config.Store.Query(q)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(reports.Reports)
+	for id, rs := range s.reports {
+		if len(q.DeviceIDs) > 0 && !slices.Contains(q.DeviceIDs, id) {
+			continue
+		}
+		for _, r := range rs {
+			if !q.From.IsZero() && r.Data.Timestamp.Before(q.From) {
+				continue
+			}
+			if !q.To.IsZero() && r.Data.Timestamp.After(q.To) {
+				continue
+			}
+			result[id] = append(result[id], r)
+		}
+	}
+	for _, rs := range result {
+		slices.SortStableFunc(rs, func(a, b reports.Report) int {
+			return a.Data.Timestamp.Compare(b.Data.Timestamp)
+		})
+	}
+	return result
+}
+
+// Handler returns the handler of the UI and the API:
+//
+//	GET /api/config             map tile configuration
+//	GET /api/status             time and error of the last refresh
+//	GET /api/devices            the devices
+//	GET /api/latest?device=ID   the latest position and estimated location of each device
+//	GET /api/tracks?device=ID&from=TIME&to=TIME
+//	                            the positions of each device in the time range, RFC 3339 times
+//
+// The device parameter may be repeated, all devices are returned without it.
+func (s *Server) Handler() http.Handler {
+	assets, _ := fs.Sub(static, "static")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(assets))
+	mux.HandleFunc("GET /api/config", s.handleConfig)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/devices", s.handleDevices)
+	mux.HandleFunc("GET /api/latest", s.handleLatest)
+	mux.HandleFunc("GET /api/tracks", s.handleTracks)
+	return mux
+}
+
+// Device is a device in API responses.
+type Device struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Icon  string `json:"icon,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// Point is a reported location.
+type Point struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Published  time.Time `json:"published"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Accuracy   uint8     `json:"accuracy"`
+	Confidence uint8     `json:"confidence"`
+	Battery    string    `json:"battery"`
+}
+
+// Position is the latest location of a device, and its location estimated from the reports
+// around it, see locate.Best.
+type Position struct {
+	Device string `json:"device"`
+	Point
+	Estimate *locate.Estimate `json:"estimate,omitempty"`
+}
+
+// Track is the locations of a device, ordered by time.
+type Track struct {
+	Device string  `json:"device"`
+	Points []Point `json:"points"`
+}
+
+// Status is the state of the last refresh.
+type Status struct {
+	LastRefresh *time.Time `json:"lastRefresh,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"tileURL":     s.config.TileURL,
+		"attribution": s.config.Attribution,
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := Status{}
+	if lastRefresh := s.lastRefresh; !lastRefresh.IsZero() {
+		status.LastRefresh = &lastRefresh
+	}
+	if s.lastErr != nil {
+		status.Error = s.lastErr.Error()
+	}
+	s.mu.Unlock()
+	writeJSON(w, status)
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	devices := make([]Device, 0, len(s.config.Devices))
+	for _, d := range s.config.Devices {
+		devices = append(devices, Device{ID: d.ID, Name: d.Name, Icon: d.Icon, Color: d.Color})
+	}
+	writeJSON(w, devices)
+}
+
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	positions := []Position{}
+	for _, id := range s.deviceIDs(r) {
+		rs := s.query(history.Query{DeviceIDs: []string{id}})[id]
+		if len(rs) == 0 {
+			continue
+		}
+		p := Position{Device: id, Point: newPoint(rs[len(rs)-1])}
+		if e, ok := locate.Best(rs, locate.Config{}); ok {
+			p.Estimate = &e
+		}
+		positions = append(positions, p)
+	}
+	writeJSON(w, positions)
+}
+
+func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
+	q := history.Query{DeviceIDs: s.deviceIDs(r)}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid "+name+" time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		*t = parsed
+	}
+
+	result := s.query(q)
+	tracks := []Track{}
+	for _, id := range q.DeviceIDs {
+		rs := result[id]
+		if len(rs) == 0 {
+			continue
+		}
+		track := Track{Device: id, Points: make([]Point, 0, len(rs))}
+		for _, report := range rs {
+			track.Points = append(track.Points, newPoint(report))
+		}
+		tracks = append(tracks, track)
+	}
+	writeJSON(w, tracks)
+}
+
+// deviceIDs returns the IDs of the devices selected by the device parameters, all devices without them.
+func (s *Server) deviceIDs(r *http.Request) []string {
+	selected := r.URL.Query()["device"]
+	ids := make([]string, 0, len(s.config.Devices))
+	for _, d := range s.config.Devices {
+		if len(selected) == 0 || slices.Contains(selected, d.ID) {
+			ids = append(ids, d.ID)
+		}
+	}
+	return ids
+}
+
+func newPoint(r reports.Report) Point {
+	return Point{
+		Timestamp:  r.Data.Timestamp,
+		Published:  r.DatePublished,
+		Latitude:   r.Data.Latitude,
+		Longitude:  r.Data.Longitude,
+		Accuracy:   r.Data.AccuracyMeters,
+		Confidence: r.Data.ConfidencePercent,
+		Battery:    findmy.BatteryStatus(r.Data.Status),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
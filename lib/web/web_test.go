@@ -0,0 +1,150 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
+	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/history"
+	"github.com/HattoriHanzo031/go-haystack/lib/reports"
+)
+
+func report(ts time.Time, lat, lon float64) reports.Report {
+	return reports.Report{
+		DatePublished: ts.Add(time.Minute),
+		Data: reports.PayloadData{
+			Timestamp:      ts,
+			Latitude:       lat,
+			Longitude:      lon,
+			AccuracyMeters: 10,
+			Status:         findmy.StatusBatteryLow,
+		},
+	}
+}
+
+func get(t *testing.T, h http.Handler, path string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	devices := []device.Device{{Name: "bag", ID: "a", Color: "#ff0000"}, {Name: "keys", ID: "b"}}
+	fetched := reports.Reports{
+		"a": {report(start.Add(time.Hour), 45.8, 15.9), report(start, 45.81, 15.97)},
+		"b": {report(start, 52.52, 13.4)},
+	}
+
+	s := New(Config{
+		Devices: devices,
+		Get: func([]device.Device) (reports.Reports, error) {
+			return fetched, nil
+		},
+	})
+	if err := s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+
+	var listed []Device
+	get(t, h, "/api/devices", &listed)
+	if len(listed) != 2 || listed[0].Name != "bag" || listed[0].Color != "#ff0000" {
+		t.Errorf("unexpected devices %+v", listed)
+	}
+
+	var latest []Position
+	get(t, h, "/api/latest", &latest)
+	if len(latest) != 2 {
+		t.Fatalf("expected 2 positions, got %d", len(latest))
+	}
+	if latest[0].Device != "a" || latest[0].Latitude != 45.8 || latest[0].Battery != "low" {
+		t.Errorf("unexpected latest position %+v", latest[0])
+	}
+	// the reports of a are an hour apart, so only the latest is within the estimate window
+	if e := latest[0].Estimate; e == nil || e.Reports != 1 || e.Latitude != 45.8 || e.Radius != 10 {
+		t.Errorf("unexpected estimate %+v", latest[0].Estimate)
+	}
+
+	var tracks []Track
+	get(t, h, "/api/tracks?device=a", &tracks)
+	if len(tracks) != 1 || len(tracks[0].Points) != 2 || !tracks[0].Points[0].Timestamp.Equal(start) {
+		t.Errorf("unexpected tracks %+v", tracks)
+	}
+
+	tracks = nil
+	get(t, h, "/api/tracks?from="+start.Add(time.Minute).Format(time.RFC3339), &tracks)
+	if len(tracks) != 1 || len(tracks[0].Points) != 1 {
+		t.Errorf("expected a single report after from, got %+v", tracks)
+	}
+
+	if rec := get(t, h, "/api/tracks?to=yesterday", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid time, got %d", rec.Code)
+	}
+
+	rec := get(t, h, "/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "map.js") {
+		t.Errorf("expected the UI to be served, got %d", rec.Code)
+	}
+}
+
+func TestServerStore(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	responses := []reports.Reports{
+		{"a": {report(start, 45.81, 15.97)}},
+		{"a": {report(start.Add(time.Hour), 45.8, 15.9)}},
+	}
+	s := New(Config{
+		Devices: []device.Device{{Name: "bag", ID: "a"}},
+		Store:   store,
+		Get: func([]device.Device) (reports.Reports, error) {
+			if len(responses) == 0 {
+				return nil, errors.New("server unavailable")
+			}
+			r := responses[0]
+			responses = responses[1:]
+			return r, nil
+		},
+	})
+	for range 2 {
+		if err := s.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Refresh(); err == nil {
+		t.Errorf("expected refresh error")
+	}
+	h := s.Handler()
+
+	// reports of earlier refreshes are kept in the store
+	var tracks []Track
+	get(t, h, "/api/tracks", &tracks)
+	if len(tracks) != 1 || len(tracks[0].Points) != 2 {
+		t.Errorf("expected 2 stored reports, got %+v", tracks)
+	}
+
+	var status Status
+	get(t, h, "/api/status", &status)
+	if status.LastRefresh == nil || status.Error != "server unavailable" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
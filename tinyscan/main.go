@@ -1,18 +1,30 @@
 package main
 
 import (
-	"encoding/hex"
 	"fmt"
 	"image/color"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/HattoriHanzo031/go-haystack/lib/device"
 	"github.com/HattoriHanzo031/go-haystack/lib/findmy"
+	"github.com/HattoriHanzo031/go-haystack/lib/scanner"
 	"tinygo.org/x/bluetooth"
 	"tinygo.org/x/tinyterm"
 )
 
+// KnownDevices is a comma separated list of NAME:KEY pairs, where KEY is the base64 advertisement key
+// of a device to be labeled by name. Set with -ldflags="-X main.KnownDevices=..."
+var KnownDevices string
+
+// SilentTimeout is how long a known device may go without advertising before it is reported as not seen.
+const SilentTimeout = 5 * time.Minute
+
 var (
 	terminal *tinyterm.Terminal
+	// terminalMu serializes the output of the scan handler and reportNotSeen
+	terminalMu sync.Mutex
 
 	black   = color.RGBA{0, 0, 0, 255}
 	adapter = bluetooth.DefaultAdapter
@@ -28,29 +40,68 @@ func main() {
 
 	terminalOutput("start scan...")
 
-	must("start scan", adapter.Scan(scanHandler))
+	devices, err := parseKnownDevices(KnownDevices)
+	must("parse known devices", err)
+	known, err := scanner.NewKnown(devices)
+	must("load known devices", err)
+	presence := scanner.NewPresence(known, time.Now())
 
+	// Scan blocks until the scan is stopped, so silent devices are reported from a separate goroutine
+	go reportNotSeen(presence)
+	must("start scan", scanner.New(scanner.Bluetooth(adapter)).Scan(presence.Handler(scanHandler)))
+}
+
+// reportNotSeen periodically reports the known devices that have not advertised for SilentTimeout.
+func reportNotSeen(presence *scanner.Presence) {
 	for {
 		time.Sleep(time.Minute)
 		terminalOutput("scanning...")
+		for _, a := range presence.NotSeen(time.Now(), SilentTimeout) {
+			if a.LastSeen.IsZero() {
+				terminalOutput(a.Device.Name + " not seen")
+			} else {
+				terminalOutput(fmt.Sprintf("%s not seen for %s", a.Device.Name, time.Since(a.LastSeen).Round(time.Second)))
+			}
+		}
 	}
 }
 
-func scanHandler(adapter *bluetooth.Adapter, device bluetooth.ScanResult) {
-	if device.ManufacturerData() != nil && device.ManufacturerData()[0].CompanyID == findmy.AppleCompanyID {
-		status, key, err := findmy.ParseData(device.Address.MAC, device.ManufacturerData()[0].Data)
-		terminalOutput("--------------------------------")
-		switch {
-		case err != nil && err == findmy.ErrorUnregistered:
-			terminalOutput(fmt.Sprintf("%s %d (unregistered)", device.Address.String(), device.RSSI))
-			return
-		case err != nil:
-			terminalOutput("ERROR: failed to parse data:" + err.Error())
-			return
+// parseKnownDevices parses the KnownDevices list. Only static keys are supported,
+// as boards without a real time clock cannot follow rolling keys.
+func parseKnownDevices(list string) ([]device.Device, error) {
+	var devices []device.Device
+	for _, entry := range strings.Split(list, ",") {
+		if entry == "" {
+			continue
 		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid known device %q, expected NAME:KEY", entry)
+		}
+		id, err := device.HashedKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid known device %s: %w", name, err)
+		}
+		devices = append(devices, device.Device{Name: name, ID: id, AdvertisementKey: key})
+	}
+	return devices, nil
+}
 
-		terminalOutput(fmt.Sprintf("%s %d (battery %s)", device.Address.String(), device.RSSI, findmy.BatteryStatus(status)))
-		terminalOutput(hex.EncodeToString(key))
+func scanHandler(event scanner.Event) {
+	adv := event.Advertisement
+	terminalOutput("--------------------------------")
+	switch event.Type {
+	case scanner.EventUnregistered:
+		terminalOutput(fmt.Sprintf("%s %d (unregistered)", adv.Address, adv.RSSI))
+	case scanner.EventInvalid:
+		terminalOutput("ERROR: failed to parse data:" + event.Err.Error())
+	default:
+		terminalOutput(fmt.Sprintf("%s %d (battery %s)", adv.Address, adv.RSSI, findmy.BatteryStatus(event.Status)))
+		if event.Device != nil {
+			terminalOutput(event.Device.Name)
+		} else {
+			terminalOutput(event.KeyHex())
+		}
 	}
 }
 
@@ -65,6 +116,8 @@ func must(action string, err error) {
 }
 
 func terminalOutput(s string) {
+	terminalMu.Lock()
+	defer terminalMu.Unlock()
 	println(s)
 	fmt.Fprintf(terminal, "\n%s", s)
 